@@ -24,8 +24,16 @@ const (
 
 func main() {
 	args := os.Args[1:]
+	if len(args) == 5 && args[0] == "node" {
+		if err := PrintNode(args[1], []byte(args[2]), args[3], args[4]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading node: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if len(args) < 3 || (args[0] != "data" && args[0] != "shape" && args[0] != "versions") {
 		fmt.Fprintln(os.Stderr, "Usage: iaviewer <data|shape|versions> <leveldb dir> <prefix> [version number]")
+		fmt.Fprintln(os.Stderr, "       iaviewer node <leveldb dir> <prefix> <version number> <nonce>")
 		fmt.Fprintln(os.Stderr, "<prefix> is the prefix of db, and the iavl tree of different modules in cosmos-sdk uses ")
 		fmt.Fprintln(os.Stderr, "different <prefix> to identify, just like \"s/k:gov/\" represents the prefix of gov module")
 		os.Exit(1)
@@ -186,3 +194,40 @@ func PrintVersions(tree *iavl.MutableTree) {
 		fmt.Printf("  %d\n", v)
 	}
 }
+
+// PrintNode prints a single node, identified by the version it was created at and its nonce
+// among the nodes of that version, without loading the tree.
+func PrintNode(dir string, prefix []byte, version, nonce string) error {
+	ver, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version number: %w", err)
+	}
+	n, err := strconv.ParseUint(nonce, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid nonce: %w", err)
+	}
+
+	db, err := OpenDB(dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if len(prefix) != 0 {
+		db = dbm.NewPrefixDB(db, prefix)
+	}
+
+	nodeKey := iavl.NewNodeKey(ver, uint32(n))
+	buf, err := db.Get(nodeKey.GetStorageKey())
+	if err != nil {
+		return err
+	}
+	if buf == nil {
+		return fmt.Errorf("node %v not found", nodeKey)
+	}
+	node, err := iavl.MakeNode(nodeKey.GetKey(), buf)
+	if err != nil {
+		return err
+	}
+	fmt.Print(node.String())
+	return nil
+}
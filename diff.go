@@ -2,6 +2,7 @@ package iavl
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/cosmos/iavl/proto"
 )
@@ -11,6 +12,65 @@ type (
 	ChangeSet = proto.ChangeSet
 )
 
+// NewKVPair returns a KVPair setting key to value.
+func NewKVPair(key, value []byte) *KVPair {
+	return &KVPair{Key: key, Value: value}
+}
+
+// NewKVDelete returns a KVPair deleting key.
+func NewKVDelete(key []byte) *KVPair {
+	return &KVPair{Key: key, Delete: true}
+}
+
+// ChangeOp is the kind of change made to a key, see KVChange.
+type ChangeOp uint8
+
+const (
+	// ChangeOpSet inserts or updates a key.
+	ChangeOpSet ChangeOp = iota
+	// ChangeOpDelete removes a key.
+	ChangeOpDelete
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeOpSet:
+		return "set"
+	case ChangeOpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("ChangeOp(%d)", uint8(op))
+	}
+}
+
+// KVChange is a change made to a key, along with the value it replaced. Unlike KVPair, which
+// only records the new state, it describes both sides of the change. OldValue is nil for
+// an inserted key, and NewValue is nil for a deleted one.
+type KVChange struct {
+	Key      []byte
+	OldValue []byte
+	NewValue []byte
+	Op       ChangeOp
+}
+
+// NewSetChange returns a KVChange setting key to newValue, oldValue being nil for an insert.
+func NewSetChange(key, oldValue, newValue []byte) KVChange {
+	return KVChange{Key: key, OldValue: oldValue, NewValue: newValue, Op: ChangeOpSet}
+}
+
+// NewDeleteChange returns a KVChange deleting key, which held oldValue.
+func NewDeleteChange(key, oldValue []byte) KVChange {
+	return KVChange{Key: key, OldValue: oldValue, Op: ChangeOpDelete}
+}
+
+// Pair returns the KVPair applying the change.
+func (c KVChange) Pair() *KVPair {
+	if c.Op == ChangeOpDelete {
+		return NewKVDelete(c.Key)
+	}
+	return NewKVPair(c.Key, c.NewValue)
+}
+
 // KVPairReceiver is callback parameter of method `extractStateChanges` to receive stream of `KVPair`s.
 type KVPairReceiver func(pair *KVPair) error
 
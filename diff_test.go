@@ -101,3 +101,24 @@ func genChangeSets(r *rand.Rand, n int) []*ChangeSet {
 	}
 	return changeSets
 }
+
+func TestKVChange(t *testing.T) {
+	require.Equal(t, &KVPair{Key: []byte("a"), Value: []byte("1")}, NewKVPair([]byte("a"), []byte("1")))
+	require.Equal(t, &KVPair{Key: []byte("a"), Delete: true}, NewKVDelete([]byte("a")))
+
+	insert := NewSetChange([]byte("a"), nil, []byte("1"))
+	require.Equal(t, KVChange{Key: []byte("a"), NewValue: []byte("1"), Op: ChangeOpSet}, insert)
+	require.Equal(t, NewKVPair([]byte("a"), []byte("1")), insert.Pair())
+
+	update := NewSetChange([]byte("a"), []byte("1"), []byte("2"))
+	require.Equal(t, []byte("1"), update.OldValue)
+	require.Equal(t, NewKVPair([]byte("a"), []byte("2")), update.Pair())
+
+	remove := NewDeleteChange([]byte("a"), []byte("2"))
+	require.Equal(t, KVChange{Key: []byte("a"), OldValue: []byte("2"), Op: ChangeOpDelete}, remove)
+	require.Equal(t, NewKVDelete([]byte("a")), remove.Pair())
+
+	require.Equal(t, "set", ChangeOpSet.String())
+	require.Equal(t, "delete", ChangeOpDelete.String())
+	require.Equal(t, "ChangeOp(7)", ChangeOp(7).String())
+}
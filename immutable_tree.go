@@ -1,12 +1,16 @@
 package iavl
 
 import (
+	"bytes"
+	"container/heap"
 	"fmt"
+	"sort"
 	"strings"
 
 	"cosmossdk.io/log"
 
 	dbm "github.com/cosmos/iavl/db"
+	ibytes "github.com/cosmos/iavl/internal/bytes"
 )
 
 // ImmutableTree contains the immutable tree at a given version. It is typically created by calling
@@ -177,7 +181,19 @@ func (t *ImmutableTree) GetWithIndex(key []byte) (int64, []byte, error) {
 // The returned value must not be modified, since it may point to data stored within IAVL.
 // Get potentially employs a more performant strategy than GetWithIndex for retrieving the value.
 // If tree.skipFastStorageUpgrade is true, this will work almost the same as GetWithIndex.
-func (t *ImmutableTree) Get(key []byte) ([]byte, error) {
+func (t *ImmutableTree) Get(key []byte) (value []byte, err error) {
+	span := t.ndb.startSpan("iavl.Get")
+	defer func() {
+		span.SetAttribute("value_bytes", int64(len(value)))
+		span.End()
+	}()
+	span.SetAttribute("version", t.version)
+	span.SetAttribute("key_bytes", int64(len(key)))
+
+	return t.get(key)
+}
+
+func (t *ImmutableTree) get(key []byte) ([]byte, error) {
 	if t.root == nil {
 		return nil, nil
 	}
@@ -215,7 +231,9 @@ func (t *ImmutableTree) Get(key []byte) ([]byte, error) {
 	return result, err
 }
 
-// GetByIndex gets the key and value at the specified index.
+// GetByIndex gets the key and value at the specified index, in the byte-sorted order of the keys,
+// see GetWithIndex. The descent uses the sizes of the subtrees, so it only visits one path. An
+// index outside [0, Size()) returns nil for both the key and the value.
 func (t *ImmutableTree) GetByIndex(index int64) (key []byte, value []byte, err error) {
 	if t.root == nil {
 		return nil, nil, nil
@@ -224,6 +242,166 @@ func (t *ImmutableTree) GetByIndex(index int64) (key []byte, value []byte, err e
 	return t.root.getByIndex(t, index)
 }
 
+// GetBatch returns the values of the given keys, in the order of the keys, with nil for the keys
+// which do not exist. Unlike calling Get for every key, the keys are resolved in a single
+// traversal which shares the descent for keys located in the same subtree. The returned values
+// must not be modified, since they may point to data stored within IAVL.
+func (t *ImmutableTree) GetBatch(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	if t.root == nil || len(keys) == 0 {
+		return values, nil
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	sortedKeys := make([][]byte, len(keys))
+	for i, idx := range order {
+		sortedKeys[i] = keys[idx]
+	}
+	sortedValues := make([][]byte, len(keys))
+	if err := t.root.getBatch(t, sortedKeys, sortedValues); err != nil {
+		return nil, err
+	}
+
+	for i, idx := range order {
+		values[idx] = sortedValues[i]
+	}
+	return values, nil
+}
+
+// WarmKeys resolves the root-to-leaf path of each of the given keys, loading every node
+// along the way into the node cache ahead of an anticipated burst of queries. Nodes shared
+// by several paths are only resolved once. Keys which are not present in the tree are
+// warmed up to the leaf where the lookup would end.
+func (t *ImmutableTree) WarmKeys(keys [][]byte) error {
+	if t.root == nil {
+		return nil
+	}
+
+	warmed := make(map[string]*Node)
+	resolve := func(node *Node, nk []byte) (*Node, error) {
+		if node != nil {
+			return node, nil
+		}
+		if cached, ok := warmed[string(nk)]; ok {
+			return cached, nil
+		}
+		node, err := t.ndb.GetNode(nk)
+		if err != nil {
+			return nil, err
+		}
+		warmed[string(nk)] = node
+		return node, nil
+	}
+
+	for _, key := range keys {
+		node := t.root
+		for !node.isLeaf() {
+			var err error
+			if bytes.Compare(key, node.key) < 0 {
+				node, err = resolve(node.leftNode, node.leftNodeKey)
+			} else {
+				node, err = resolve(node.rightNode, node.rightNodeKey)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LeafInfo describes the size of a single leaf, see ImmutableTree.LargestLeaves.
+type LeafInfo struct {
+	Key       []byte
+	ValueSize int
+}
+
+// leafInfoHeap is a min-heap of leaves, holding the smallest of the largest leaves at the top.
+type leafInfoHeap []LeafInfo
+
+// smallerLeaf orders leaves by value size, and by descending key among equal sizes.
+func smallerLeaf(a, b LeafInfo) bool {
+	if a.ValueSize != b.ValueSize {
+		return a.ValueSize < b.ValueSize
+	}
+	return bytes.Compare(a.Key, b.Key) > 0
+}
+
+func (h leafInfoHeap) Len() int            { return len(h) }
+func (h leafInfoHeap) Less(i, j int) bool  { return smallerLeaf(h[i], h[j]) }
+func (h leafInfoHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *leafInfoHeap) Push(x interface{}) { *h = append(*h, x.(LeafInfo)) }
+func (h *leafInfoHeap) Pop() (last interface{}) {
+	last, *h = (*h)[len(*h)-1], (*h)[:len(*h)-1]
+	return last
+}
+
+// LargestLeaves returns the n leaves with the biggest values, by descending value size and
+// ascending key among equal sizes. It scans every leaf of the tree, keeping only the top n.
+func (t *ImmutableTree) LargestLeaves(n int) ([]LeafInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("n must be positive, got %d", n)
+	}
+
+	h := make(leafInfoHeap, 0, n)
+	_, err := t.Iterate(func(key, value []byte) bool {
+		leaf := LeafInfo{Key: key, ValueSize: len(value)}
+		switch {
+		case h.Len() < n:
+			leaf.Key = ibytes.Cp(key)
+			heap.Push(&h, leaf)
+		case smallerLeaf(h[0], leaf):
+			leaf.Key = ibytes.Cp(key)
+			h[0] = leaf
+			heap.Fix(&h, 0)
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make([]LeafInfo, h.Len())
+	for i := len(leaves) - 1; i >= 0; i-- {
+		leaves[i] = heap.Pop(&h).(LeafInfo)
+	}
+	return leaves, nil
+}
+
+// TreeStats summarizes the size of a tree, see ImmutableTree.Stats.
+type TreeStats struct {
+	Leaves     int64
+	Branches   int64
+	Height     int8
+	KeyBytes   int64
+	ValueBytes int64
+}
+
+// Stats returns the size of the tree. The node counts and the height are read from the root,
+// while the key and value sizes require scanning every leaf.
+func (t *ImmutableTree) Stats() (TreeStats, error) {
+	var stats TreeStats
+	if t.root == nil {
+		return stats, nil
+	}
+	stats.Leaves = t.root.size
+	stats.Branches = t.root.size - 1
+	stats.Height = t.root.subtreeHeight
+	_, err := t.Iterate(func(key, value []byte) bool {
+		stats.KeyBytes += int64(len(key))
+		stats.ValueBytes += int64(len(value))
+		return false
+	})
+	return stats, err
+}
+
 // Iterate iterates over all keys of the tree. The keys and values must not be modified,
 // since they may point to data stored within IAVL. Returns true if stopped by callback, false otherwise
 func (t *ImmutableTree) Iterate(fn func(key []byte, value []byte) bool) (bool, error) {
@@ -245,6 +423,15 @@ func (t *ImmutableTree) Iterate(fn func(key []byte, value []byte) bool) (bool, e
 	return false, nil
 }
 
+// PrefixIterator returns an iterator over the keys with the given prefix. An empty prefix
+// iterates over the whole tree.
+func (t *ImmutableTree) PrefixIterator(prefix []byte, ascending bool) (dbm.Iterator, error) {
+	if len(prefix) == 0 {
+		return t.Iterator(nil, nil, ascending)
+	}
+	return t.Iterator(prefix, prefixEnd(prefix), ascending)
+}
+
 // Iterator returns an iterator over the immutable tree.
 func (t *ImmutableTree) Iterator(start, end []byte, ascending bool) (dbm.Iterator, error) {
 	if !t.skipFastStorageUpgrade {
@@ -172,6 +172,9 @@ func (i *Importer) Add(exportNode *ExportNode) error {
 		leftNode.rightNode = nil
 		rightNode.leftNode = nil
 		rightNode.rightNode = nil
+	} else {
+		return fmt.Errorf("invalid node structure, inner node at height %v must follow its children",
+			node.subtreeHeight)
 	}
 	i.nonces[exportNode.Version]++
 	node.nodeKey = &NodeKey{
@@ -1,6 +1,7 @@
 package iavl
 
 import (
+	"bytes"
 	"testing"
 
 	"cosmossdk.io/log"
@@ -127,6 +128,7 @@ func TestImporter_Add(t *testing.T) {
 		"no value":          {&ExportNode{Key: k, Value: nil, Version: 1, Height: 0}, false},
 		"version too large": {&ExportNode{Key: k, Value: v, Version: 2, Height: 0}, false},
 		"no version":        {&ExportNode{Key: k, Value: v, Version: 0, Height: 0}, false},
+		"no children":       {&ExportNode{Key: k, Value: nil, Version: 1, Height: 1}, false},
 		// further cases will be handled by Node.validate()
 	}
 	for desc, tc := range testcases {
@@ -150,6 +152,23 @@ func TestImporter_Add(t *testing.T) {
 	}
 }
 
+func TestImporter_Add_BranchBeforeChildren(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	importer, err := tree.Import(1)
+	require.NoError(t, err)
+	defer importer.Close()
+
+	require.NoError(t, importer.Add(&ExportNode{Key: []byte("a"), Value: []byte("value"), Version: 1, Height: 0}))
+	err = importer.Add(&ExportNode{Key: []byte("b"), Version: 1, Height: 1})
+	require.ErrorContains(t, err, "must follow its children")
+
+	// the rejected node leaves the importer usable
+	require.NoError(t, importer.Add(&ExportNode{Key: []byte("b"), Value: []byte("value"), Version: 1, Height: 0}))
+	require.NoError(t, importer.Add(&ExportNode{Key: []byte("b"), Version: 1, Height: 1}))
+	require.NoError(t, importer.Commit())
+	require.EqualValues(t, 2, tree.Size())
+}
+
 func TestImporter_Add_Closed(t *testing.T) {
 	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
 	importer, err := tree.Import(1)
@@ -272,3 +291,57 @@ func benchmarkImport(b *testing.B, nodes int) {
 		require.NoError(b, err)
 	}
 }
+
+func TestImporter_Finalize(t *testing.T) {
+	source := setupExportTreeSized(t, 1000)
+	exporter, err := source.Export()
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	importer, err := tree.Import(source.Version())
+	require.NoError(t, err)
+	defer importer.Close()
+	for {
+		item, err := exporter.Next()
+		if err == ErrorExportDone {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, importer.Add(item))
+	}
+	require.NoError(t, importer.Commit())
+
+	report, err := tree.Finalize(source.Version())
+	require.NoError(t, err)
+	require.Equal(t, source.Version(), report.Version)
+	require.Equal(t, source.Hash(), report.Hash)
+	require.Equal(t, report.Hash, report.ComputedHash)
+	require.EqualValues(t, 1000, report.Leaves)
+	require.EqualValues(t, 1000, report.StoredLeaves)
+
+	// the working version is saved before it is checked
+	_, err = tree.Set([]byte("new"), []byte("value"))
+	require.NoError(t, err)
+	report, err = tree.Finalize(tree.WorkingVersion())
+	require.NoError(t, err)
+	require.Equal(t, tree.Version(), report.Version)
+	require.Equal(t, tree.Hash(), report.ComputedHash)
+	require.EqualValues(t, 1001, report.StoredLeaves)
+
+	// tamper with a stored leaf behind the tree's back
+	leaves, err := tree.ndb.leafNodes()
+	require.NoError(t, err)
+	leaf := leaves[0]
+	leaf.value = []byte("tampered")
+	var buf bytes.Buffer
+	require.NoError(t, leaf.writeBytes(&buf))
+	require.NoError(t, db.Set(tree.ndb.nodeKey(leaf.GetKey()), buf.Bytes()))
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	_, err = tree.Load()
+	require.NoError(t, err)
+	_, err = tree.Finalize(tree.Version())
+	require.ErrorContains(t, err, "but its content hashes to")
+}
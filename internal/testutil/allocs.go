@@ -0,0 +1,13 @@
+// Package testutil contains helpers shared by the tests of this module.
+package testutil
+
+import "testing"
+
+// allocRuns is the number of runs the allocations are averaged over.
+const allocRuns = 100
+
+// MeasureAllocs returns the average number of heap allocations made by a call to fn. fn is
+// called once beforehand to warm up, so it must be safe to repeat.
+func MeasureAllocs(fn func()) float64 {
+	return testing.AllocsPerRun(allocRuns, fn)
+}
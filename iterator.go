@@ -184,6 +184,8 @@ type Iterator struct {
 var _ dbm.Iterator = (*Iterator)(nil)
 
 // Returns a new iterator over the immutable tree. If the tree is nil, the iterator will be invalid.
+// The iterator pins the root of the tree at creation and traverses that structure, reloading
+// persisted children by their node keys, so it is unaffected by later updates to the tree.
 func NewIterator(start, end []byte, ascending bool, tree *ImmutableTree) dbm.Iterator {
 	iter := &Iterator{
 		start: start,
@@ -1,6 +1,7 @@
 package iavl
 
 import (
+	"fmt"
 	"math/rand"
 	"sort"
 	"sync"
@@ -381,3 +382,117 @@ func syncMapCount(m *sync.Map) int {
 	})
 	return count
 }
+
+func TestIterator_SnapshotIsolation(t *testing.T) {
+	for _, skipFastStorageUpgrade := range []bool{false, true} {
+		tree := NewMutableTree(dbm.NewMemDB(), 0, skipFastStorageUpgrade, log.NewNopLogger())
+		for i := 0; i < 100; i++ {
+			_, err := tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte("saved"))
+			require.NoError(t, err)
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+		// unsaved changes present when the iterator is created are observed
+		for i := 100; i < 150; i++ {
+			_, err := tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte("unsaved"))
+			require.NoError(t, err)
+		}
+		for i := 0; i < 10; i++ {
+			_, _, err := tree.Remove([]byte(fmt.Sprintf("key%03d", i)))
+			require.NoError(t, err)
+		}
+
+		expected := [][]byte{}
+		_, err = tree.Iterate(func(key, _ []byte) bool {
+			expected = append(expected, key)
+			return false
+		})
+		require.NoError(t, err)
+		require.Len(t, expected, 140)
+
+		itr, err := tree.Iterator(nil, nil, true)
+		require.NoError(t, err)
+
+		errs := make(chan error, 1)
+		go func() {
+			for i := 0; i < 200; i += 2 {
+				if _, err := tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte("updated")); err != nil {
+					errs <- err
+					return
+				}
+				if _, _, err := tree.Remove([]byte(fmt.Sprintf("key%03d", i+1))); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+
+		actual := [][]byte{}
+		for ; itr.Valid(); itr.Next() {
+			actual = append(actual, itr.Key())
+			require.NotEqual(t, []byte("updated"), itr.Value())
+		}
+		require.NoError(t, itr.Close())
+		require.NoError(t, <-errs)
+
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestIterator_Prefix(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	keys := [][]byte{
+		{0x00}, {'a'}, {'a', 0x00}, {'a', 'b'}, {'a', 0xff}, {'a', 0xff, 0x01}, {'b'},
+		{0xff}, {0xff, 0xff}, {0xff, 0xff, 0x01},
+	}
+	for _, key := range keys {
+		_, err := tree.Set(key, []byte("value"))
+		require.NoError(t, err)
+	}
+
+	collect := func(itr dbm.Iterator, err error) (res [][]byte) {
+		require.NoError(t, err)
+		defer itr.Close()
+		for ; itr.Valid(); itr.Next() {
+			res = append(res, itr.Key())
+		}
+		require.NoError(t, itr.Error())
+		return res
+	}
+	reversed := func(s [][]byte) (res [][]byte) {
+		for i := len(s) - 1; i >= 0; i-- {
+			res = append(res, s[i])
+		}
+		return res
+	}
+
+	testcases := map[string]struct {
+		prefix   []byte
+		expected [][]byte
+	}{
+		"empty":           {nil, keys},
+		"single byte":     {[]byte{'a'}, keys[1:6]},
+		"ending in 0xff":  {[]byte{'a', 0xff}, keys[4:6]},
+		"only 0xff bytes": {[]byte{0xff, 0xff}, keys[8:]},
+		"no match":        {[]byte{'c'}, nil},
+	}
+	for desc, tc := range testcases {
+		tc := tc
+		t.Run(desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, collect(tree.PrefixIterator(tc.prefix, true)))
+			require.Equal(t, reversed(tc.expected), collect(tree.PrefixIterator(tc.prefix, false)))
+		})
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+	for desc, tc := range testcases {
+		tc := tc
+		t.Run(desc+" saved", func(t *testing.T) {
+			immutable, err := tree.GetImmutable(tree.Version())
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, collect(immutable.PrefixIterator(tc.prefix, true)))
+			require.Equal(t, reversed(tc.expected), collect(immutable.PrefixIterator(tc.prefix, false)))
+		})
+	}
+}
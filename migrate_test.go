@@ -343,3 +343,76 @@ func TestRandomSet(t *testing.T) {
 	err = tree.DeleteVersionsTo(int64(legacyVersion + postVersions - 1))
 	require.NoError(t, err)
 }
+
+func TestRevertSaveVersionLegacy(t *testing.T) {
+	legacyVersion := 20
+	dbDir := fmt.Sprintf("./legacy-%s-%d", dbType, legacyVersion)
+	relateDir, err := createLegacyTree(t, dbDir, legacyVersion)
+	require.NoError(t, err)
+
+	legacyDB, err := dbm.NewDB("test", dbType, relateDir)
+	require.NoError(t, err)
+	legacy := dumpDB(t, legacyDB)
+	require.NoError(t, legacyDB.Close())
+	require.NoError(t, os.RemoveAll(relateDir))
+
+	testCases := map[string]bool{
+		"unchanged legacy root": false,
+		"updated legacy tree":   true,
+	}
+	for name, update := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// fail each write of SaveVersion in turn, flushing the batch on every write
+			for failAfter := 0; ; failAfter++ {
+				memDB := dbm.NewMemDB()
+				for k, v := range legacy {
+					require.NoError(t, memDB.Set([]byte(k), []byte(v)))
+				}
+				db := &flakyDB{DB: memDB}
+				tree := NewMutableTree(db, 1000, false, log.NewNopLogger(), FlushThresholdOption(1))
+				_, err := tree.LoadVersion(int64(legacyVersion))
+				require.NoError(t, err)
+
+				var updated, removed []byte
+				if update {
+					updated, _, err = tree.GetByIndex(0)
+					require.NoError(t, err)
+					removed, _, err = tree.GetByIndex(1)
+					require.NoError(t, err)
+					_, err = tree.Set(updated, []byte("updated"))
+					require.NoError(t, err)
+					_, err = tree.Set([]byte("new key"), []byte("new value"))
+					require.NoError(t, err)
+					_, _, err = tree.Remove(removed)
+					require.NoError(t, err)
+				}
+
+				before := dumpDB(t, db)
+				db.failAt = db.writes + failAfter + 1
+				_, _, err = tree.SaveVersion()
+				if err == nil {
+					require.Positive(t, failAfter)
+					return
+				}
+				require.Equal(t, before, dumpDB(t, db), "fail after %d writes", failAfter)
+
+				hash, version, err := tree.SaveVersion()
+				require.NoError(t, err)
+				require.Equal(t, int64(legacyVersion+1), version)
+
+				reloaded := NewMutableTree(db, 1000, false, log.NewNopLogger())
+				_, err = reloaded.Load()
+				require.NoError(t, err)
+				require.Equal(t, hash, reloaded.Hash())
+				if update {
+					value, err := reloaded.Get(updated)
+					require.NoError(t, err)
+					require.Equal(t, []byte("updated"), value)
+					value, err = reloaded.Get(removed)
+					require.NoError(t, err)
+					require.Nil(t, value)
+				}
+			}
+		})
+	}
+}
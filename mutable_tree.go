@@ -2,10 +2,13 @@ package iavl
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "cosmossdk.io/log"
 
@@ -20,6 +23,16 @@ var (
 
 	// ErrKeyDoesNotExist is returned if a key does not exist.
 	ErrKeyDoesNotExist = errors.New("key does not exist")
+
+	// ErrVersionInGap is returned when loading a version which is missing between two available
+	// versions, e.g. after an incomplete restore. It wraps ErrVersionDoesNotExist.
+	ErrVersionInGap = fmt.Errorf("%w: version is in a gap", ErrVersionDoesNotExist)
+
+	// ErrReadOnly is returned when mutating a tree opened with Options.ReadOnlyLowMem.
+	ErrReadOnly = errors.New("tree is read-only")
+
+	// ErrTreeClosed is returned when mutating a tree after MutableTree.Close.
+	ErrTreeClosed = errors.New("tree is closed")
 )
 
 type Option func(*Options)
@@ -35,12 +48,14 @@ type Option func(*Options)
 type MutableTree struct {
 	logger log.Logger
 
-	*ImmutableTree                          // The current, working tree.
-	lastSaved                *ImmutableTree // The most recently saved tree.
-	unsavedFastNodeAdditions *sync.Map      // map[string]*FastNode FastNodes that have not yet been saved to disk
-	unsavedFastNodeRemovals  *sync.Map      // map[string]interface{} FastNodes that have not yet been removed from disk
+	*ImmutableTree                                  // The current, working tree.
+	lastSaved                *ImmutableTree         // The most recently saved tree.
+	unsavedFastNodeAdditions *sync.Map              // map[string]*FastNode FastNodes that have not yet been saved to disk
+	unsavedFastNodeRemovals  *sync.Map              // map[string]interface{} FastNodes that have not yet been removed from disk
+	unsavedChecksums         map[string]setChecksum // Checksums of the slices given to Set, with Options.DetectMutation
 	ndb                      *nodeDB
-	skipFastStorageUpgrade   bool // If true, the tree will work like no fast storage and always not upgrade fast storage
+	skipFastStorageUpgrade   bool        // If true, the tree will work like no fast storage and always not upgrade fast storage
+	closed                   atomic.Bool // Set by Close, the tree can then neither be loaded, read nor mutated
 
 	mtx sync.Mutex
 }
@@ -52,6 +67,11 @@ func NewMutableTree(db dbm.DB, cacheSize int, skipFastStorageUpgrade bool, lg lo
 		opt(&opts)
 	}
 
+	// the fast index is a second copy of the latest state, a low-memory reader walks the tree instead
+	if opts.ReadOnlyLowMem {
+		skipFastStorageUpgrade = true
+	}
+
 	ndb := newNodeDB(db, cacheSize, opts, lg)
 	head := &ImmutableTree{ndb: ndb, skipFastStorageUpgrade: skipFastStorageUpgrade}
 
@@ -72,8 +92,29 @@ func (tree *MutableTree) IsEmpty() bool {
 	return tree.ImmutableTree.Size() == 0
 }
 
+// LatestVersion returns the latest version saved in the database, 0 if there is none. Unlike
+// Version, it does not require loading the tree, e.g. to decide which blocks to replay on startup.
+func (tree *MutableTree) LatestVersion() (int64, error) {
+	if err := tree.checkOpen(); err != nil {
+		return 0, err
+	}
+	return tree.ndb.getLatestVersion()
+}
+
+// FirstVersion returns the first version saved in the database and not yet pruned, 0 if there is
+// none. It does not require loading the tree.
+func (tree *MutableTree) FirstVersion() (int64, error) {
+	if err := tree.checkOpen(); err != nil {
+		return 0, err
+	}
+	return tree.ndb.getFirstVersion()
+}
+
 // VersionExists returns whether or not a version exists.
 func (tree *MutableTree) VersionExists(version int64) bool {
+	if tree.closed.Load() {
+		return false
+	}
 	legacyLatestVersion, err := tree.ndb.getLegacyLatestVersion()
 	if err != nil {
 		return false
@@ -91,42 +132,166 @@ func (tree *MutableTree) VersionExists(version int64) bool {
 		return false
 	}
 
-	return firstVersion <= version && version <= latestVersion
+	if version < firstVersion || version > latestVersion {
+		return false
+	}
+	has, err := tree.ndb.hasVersion(version)
+	return err == nil && has
 }
 
-// AvailableVersions returns all available versions in ascending order
+// AvailableVersions returns all available versions in ascending order, i.e. the versions which can
+// be loaded or queried after pruning or a partial restore.
 func (tree *MutableTree) AvailableVersions() []int {
-	firstVersion, err := tree.ndb.getFirstVersion()
-	if err != nil {
+	if tree.closed.Load() {
 		return nil
 	}
-	latestVersion, err := tree.ndb.getLatestVersion()
+	res := make([]int, 0)
+	if err := tree.ndb.traverseAvailableVersions(func(version int64) error {
+		res = append(res, int(version))
+		return nil
+	}); err != nil {
+		return nil
+	}
+	return res
+}
+
+// VersionGaps returns the inclusive ranges of versions which are missing between the first and
+// the latest available versions, in ascending order. A tree only ever pruned from the start,
+// which is the case unless the database was restored partially, has no gaps.
+func (tree *MutableTree) VersionGaps() ([][2]int64, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
+	return tree.ndb.versionGaps()
+}
+
+// VerifyLeafCount checks that every leaf of the given version is present in the database, by
+// comparing the size recorded in its root with the number of stored leaves reachable from it.
+// Each stored node is read once, without hashing or caching it, so it is much cheaper than
+// verifying the hashes. It catches truncated imports or restores.
+func (tree *MutableTree) VerifyLeafCount(version int64) error {
+	if err := tree.checkOpen(); err != nil {
+		return err
+	}
+	rootNodeKey, err := tree.ndb.GetRoot(version)
 	if err != nil {
+		return err
+	}
+	if rootNodeKey == nil {
 		return nil
 	}
-	legacyLatestVersion, err := tree.ndb.getLegacyLatestVersion()
+	root, err := tree.ndb.GetNode(rootNodeKey)
 	if err != nil {
+		return err
+	}
+	count, err := tree.ndb.countStoredLeaves(rootNodeKey)
+	if err != nil {
+		return err
+	}
+	if count != root.size {
+		return fmt.Errorf("version %d has %d leaves according to its root, but %d are stored", version, root.size, count)
+	}
+	return nil
+}
+
+// VerifyPersisted checks that every node of the latest saved version, as held in memory and in
+// the node cache, matches its stored form. It is meant as a self-check after commits, e.g. while
+// bringing up a new database backend.
+func (tree *MutableTree) VerifyPersisted() error {
+	if err := tree.checkOpen(); err != nil {
+		return err
+	}
+	if tree.lastSaved.root == nil {
 		return nil
 	}
+	return tree.ndb.verifyPersisted(tree.lastSaved.root)
+}
 
-	res := make([]int, 0)
-	if legacyLatestVersion > firstVersion {
-		for version := firstVersion; version < legacyLatestVersion; version++ {
-			has, err := tree.ndb.hasLegacyVersion(version)
-			if err != nil {
-				return nil
-			}
-			if has {
-				res = append(res, int(version))
-			}
+// FinalizeReport describes a version checked by MutableTree.Finalize.
+type FinalizeReport struct {
+	Version      int64
+	Hash         []byte // the root hash stored for the version
+	ComputedHash []byte // the root hash recomputed from the stored nodes
+	Leaves       int64  // the number of leaves according to the root
+	StoredLeaves int64  // the number of leaves present in the database
+}
+
+// Finalize checks that a version, typically just imported, is complete and correct before it
+// is served: every leaf must be stored, and every stored node must hash to its recorded hash.
+// If version is the working version, it is saved first. Durability of the write follows
+// Options.Sync, while Importer.Commit always syncs.
+func (tree *MutableTree) Finalize(version int64) (FinalizeReport, error) {
+	if err := tree.checkOpen(); err != nil {
+		return FinalizeReport{}, err
+	}
+	report := FinalizeReport{Version: version}
+	if version == tree.WorkingVersion() {
+		if _, _, err := tree.SaveVersion(); err != nil {
+			return report, err
 		}
-		firstVersion = legacyLatestVersion
 	}
 
-	for version := firstVersion; version <= latestVersion; version++ {
-		res = append(res, int(version))
+	rootNodeKey, err := tree.ndb.GetRoot(version)
+	if err != nil {
+		return report, err
 	}
-	return res
+	if rootNodeKey == nil {
+		report.Hash = sha256.New().Sum(nil)
+		report.ComputedHash = report.Hash
+		return report, nil
+	}
+	root, err := tree.ndb.GetNode(rootNodeKey)
+	if err != nil {
+		return report, err
+	}
+	report.Hash, report.Leaves = root.hash, root.size
+
+	report.StoredLeaves, err = tree.ndb.countStoredLeaves(rootNodeKey)
+	if err != nil {
+		return report, err
+	}
+	if report.StoredLeaves != report.Leaves {
+		return report, fmt.Errorf("version %d has %d leaves according to its root, but %d are stored",
+			version, report.Leaves, report.StoredLeaves)
+	}
+
+	computed, err := tree.ndb.verifyNode(rootNodeKey)
+	if err != nil {
+		return report, err
+	}
+	report.ComputedHash = computed.hash
+	if !bytes.Equal(report.ComputedHash, report.Hash) {
+		return report, fmt.Errorf("version %d has root hash %X, but its nodes hash to %X",
+			version, report.Hash, report.ComputedHash)
+	}
+	return report, nil
+}
+
+// VerifyIntegrity checks that every node of a saved version is consistent with its stored
+// children: its hash must match its recomputed content, and its size and height must agree with
+// its children's. The error names the first node found corrupted. Unlike Finalize, it neither
+// saves the working version nor checks for missing leaves, which fail to load instead.
+func (tree *MutableTree) VerifyIntegrity(version int64) error {
+	if err := tree.checkOpen(); err != nil {
+		return err
+	}
+	rootNodeKey, err := tree.ndb.GetRoot(version)
+	if err != nil {
+		return err
+	}
+	if rootNodeKey == nil {
+		return nil
+	}
+	_, err = tree.ndb.verifyNode(rootNodeKey)
+	return err
+}
+
+// ReleaseMemory drops the node caches of a long-lived tree to shrink its memory footprint.
+// Saved nodes are not linked to their children once committed, so nothing else holds them,
+// and subsequent queries reload them from the database on demand. Unsaved changes of the
+// working tree are kept.
+func (tree *MutableTree) ReleaseMemory() {
+	tree.ndb.clearCaches()
 }
 
 // Hash returns the hash of the latest saved version of the tree, as returned
@@ -150,24 +315,62 @@ func (tree *MutableTree) WorkingVersion() int64 {
 
 // String returns a string representation of the tree.
 func (tree *MutableTree) String() (string, error) {
+	if err := tree.checkOpen(); err != nil {
+		return "", err
+	}
 	return tree.ndb.String()
 }
 
 // Set sets a key in the working tree. Nil values are invalid. The given
 // key/value byte slices must not be modified after this call, since they point
-// to slices stored within IAVL. It returns true when an existing value was
-// updated, while false means it was a new key.
+// to slices stored within IAVL. The key and value may share a backing array, e.g. when
+// both are parsed from a single buffer, since IAVL never writes to nor appends to either.
+// It returns true when an existing value was updated, while false means it was a new key.
 func (tree *MutableTree) Set(key, value []byte) (updated bool, err error) {
+	if err := tree.checkWritable(); err != nil {
+		return false, err
+	}
+	span := tree.ndb.startSpan("iavl.Set")
+	defer span.End()
+	span.SetAttribute("version", tree.WorkingVersion())
+	span.SetAttribute("key_bytes", int64(len(key)))
+	span.SetAttribute("value_bytes", int64(len(value)))
+
 	updated, err = tree.set(key, value)
 	if err != nil {
 		return false, err
 	}
+	if tree.ndb.opts.DetectMutation {
+		tree.recordChecksum(key, value)
+	}
+	if err := tree.writeTrace(traceOpSet, key, value); err != nil {
+		return updated, err
+	}
 	return updated, nil
 }
 
+// Has returns whether the working tree has the key.
+func (tree *MutableTree) Has(key []byte) (bool, error) {
+	if err := tree.checkOpen(); err != nil {
+		return false, err
+	}
+	return tree.ImmutableTree.Has(key)
+}
+
 // Get returns the value of the specified key if it exists, or nil otherwise.
 // The returned value must not be modified, since it may point to data stored within IAVL.
-func (tree *MutableTree) Get(key []byte) ([]byte, error) {
+func (tree *MutableTree) Get(key []byte) (value []byte, err error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
+	span := tree.ndb.startSpan("iavl.Get")
+	defer func() {
+		span.SetAttribute("value_bytes", int64(len(value)))
+		span.End()
+	}()
+	span.SetAttribute("version", tree.WorkingVersion())
+	span.SetAttribute("key_bytes", int64(len(key)))
+
 	if tree.root == nil {
 		return nil, nil
 	}
@@ -182,7 +385,7 @@ func (tree *MutableTree) Get(key []byte) ([]byte, error) {
 		}
 	}
 
-	return tree.ImmutableTree.Get(key)
+	return tree.ImmutableTree.get(key)
 }
 
 // Import returns an importer for tree nodes previously exported by ImmutableTree.Export(),
@@ -194,12 +397,18 @@ func (tree *MutableTree) Get(key []byte) ([]byte, error) {
 // Import can only be called on an empty tree. It is the callers responsibility that no other
 // modifications are made to the tree while importing.
 func (tree *MutableTree) Import(version int64) (*Importer, error) {
+	if err := tree.checkWritable(); err != nil {
+		return nil, err
+	}
 	return newImporter(tree, version)
 }
 
 // Iterate iterates over all keys of the tree. The keys and values must not be modified,
 // since they may point to data stored within IAVL. Returns true if stopped by callnack, false otherwise
 func (tree *MutableTree) Iterate(fn func(key []byte, value []byte) bool) (stopped bool, err error) {
+	if err := tree.checkOpen(); err != nil {
+		return false, err
+	}
 	if tree.root == nil {
 		return false, nil
 	}
@@ -226,9 +435,23 @@ func (tree *MutableTree) Iterate(fn func(key []byte, value []byte) bool) (stoppe
 	return false, nil
 }
 
-// Iterator returns an iterator over the mutable tree.
-// CONTRACT: no updates are made to the tree while an iterator is active.
+// PrefixIterator returns an iterator over the keys with the given prefix, including unsaved
+// changes like Iterator. An empty prefix iterates over the whole tree.
+func (tree *MutableTree) PrefixIterator(prefix []byte, ascending bool) (dbm.Iterator, error) {
+	if len(prefix) == 0 {
+		return tree.Iterator(nil, nil, ascending)
+	}
+	return tree.Iterator(prefix, prefixEnd(prefix), ascending)
+}
+
+// Iterator returns an iterator over the mutable tree. The iterator sees the working tree as of
+// its creation: keys set or removed afterwards are not observed, so the tree may keep being
+// updated while the iterator is active.
+// CONTRACT: the tree is not saved while an iterator is active.
 func (tree *MutableTree) Iterator(start, end []byte, ascending bool) (dbm.Iterator, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
 	if !tree.skipFastStorageUpgrade {
 		isFastCacheEnabled, err := tree.IsFastCacheEnabled()
 		if err != nil {
@@ -247,6 +470,9 @@ func (tree *MutableTree) set(key []byte, value []byte) (updated bool, err error)
 	if value == nil {
 		return updated, fmt.Errorf("attempt to store nil value at key '%s'", key)
 	}
+	if err := tree.validateKey(key); err != nil {
+		return updated, err
+	}
 
 	if tree.ImmutableTree.root == nil {
 		if !tree.skipFastStorageUpgrade {
@@ -328,9 +554,83 @@ func (tree *MutableTree) recursiveSetLeaf(node *Node, key []byte, value []byte)
 	}
 }
 
+// checkOpen returns ErrTreeClosed if the tree was closed.
+func (tree *MutableTree) checkOpen() error {
+	if tree.closed.Load() {
+		return ErrTreeClosed
+	}
+	return nil
+}
+
+// checkWritable returns ErrTreeClosed if the tree was closed, or ErrReadOnly if it was opened
+// with Options.ReadOnlyLowMem.
+func (tree *MutableTree) checkWritable() error {
+	if err := tree.checkOpen(); err != nil {
+		return err
+	}
+	if tree.ndb.opts.ReadOnlyLowMem {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// setChecksum is the checksum of a key and value given to Set, see Options.DetectMutation.
+type setChecksum struct {
+	key, value []byte
+	sum        [sha256.Size]byte
+}
+
+func checksumKeyValue(key, value []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(key)
+	h.Write(value)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// recordChecksum records the checksum of a key and value given to Set, to be verified by
+// checkUnmodified.
+func (tree *MutableTree) recordChecksum(key, value []byte) {
+	if tree.unsavedChecksums == nil {
+		tree.unsavedChecksums = make(map[string]setChecksum)
+	}
+	tree.unsavedChecksums[string(key)] = setChecksum{key: key, value: value, sum: checksumKeyValue(key, value)}
+}
+
+// checkUnmodified verifies that none of the keys and values given to Set since the last saved
+// version were modified by the caller since.
+func (tree *MutableTree) checkUnmodified() error {
+	for original, c := range tree.unsavedChecksums {
+		if checksumKeyValue(c.key, c.value) != c.sum {
+			return fmt.Errorf("the key or value of %X was modified after Set", original)
+		}
+	}
+	return nil
+}
+
+// validateKey runs the configured KeyValidator, if any, on the key.
+func (tree *MutableTree) validateKey(key []byte) error {
+	if tree.ndb.opts.KeyValidator == nil {
+		return nil
+	}
+	return tree.ndb.opts.KeyValidator(key)
+}
+
 // Remove removes a key from the working tree. The given key byte slice should not be modified
 // after this call, since it may point to data stored inside IAVL.
 func (tree *MutableTree) Remove(key []byte) ([]byte, bool, error) {
+	if err := tree.checkWritable(); err != nil {
+		return nil, false, err
+	}
+	span := tree.ndb.startSpan("iavl.Remove")
+	defer span.End()
+	span.SetAttribute("version", tree.WorkingVersion())
+	span.SetAttribute("key_bytes", int64(len(key)))
+
+	if err := tree.validateKey(key); err != nil {
+		return nil, false, err
+	}
 	if tree.root == nil {
 		return nil, false, nil
 	}
@@ -347,6 +647,10 @@ func (tree *MutableTree) Remove(key []byte) ([]byte, bool, error) {
 	}
 
 	tree.root = newRoot
+	delete(tree.unsavedChecksums, string(key))
+	if err := tree.writeTrace(traceOpRemove, key); err != nil {
+		return value, true, err
+	}
 	return value, true, nil
 }
 
@@ -435,6 +739,9 @@ func (tree *MutableTree) Load() (int64, error) {
 
 // Returns the version number of the specific version found
 func (tree *MutableTree) LoadVersion(targetVersion int64) (int64, error) {
+	if err := tree.checkOpen(); err != nil {
+		return 0, err
+	}
 	firstVersion, err := tree.ndb.getFirstVersion()
 	if err != nil {
 		return 0, err
@@ -476,6 +783,9 @@ func (tree *MutableTree) LoadVersion(targetVersion int64) (int64, error) {
 		targetVersion = latestVersion
 	}
 	if !tree.VersionExists(targetVersion) {
+		if targetVersion < latestVersion {
+			return 0, tree.ndb.versionGapError(targetVersion)
+		}
 		return 0, ErrVersionDoesNotExist
 	}
 	rootNodeKey, err := tree.ndb.GetRoot(targetVersion)
@@ -512,6 +822,9 @@ func (tree *MutableTree) LoadVersion(targetVersion int64) (int64, error) {
 // loadVersionForOverwriting attempts to load a tree at a previously committed
 // version, or the latest version below it. Any versions greater than targetVersion will be deleted.
 func (tree *MutableTree) LoadVersionForOverwriting(targetVersion int64) error {
+	if err := tree.checkWritable(); err != nil {
+		return err
+	}
 	if _, err := tree.LoadVersion(targetVersion); err != nil {
 		return err
 	}
@@ -541,6 +854,9 @@ func (tree *MutableTree) LoadVersionForOverwriting(targetVersion int64) error {
 // An example of when an upgrade may be performed is when we are enaling fast storage for the first time or
 // need to overwrite fast nodes due to mismatch with live state.
 func (tree *MutableTree) IsUpgradeable() (bool, error) {
+	if err := tree.checkOpen(); err != nil {
+		return false, err
+	}
 	shouldForce, err := tree.ndb.shouldForceFastStorageUpgrade()
 	if err != nil {
 		return false, err
@@ -615,6 +931,9 @@ func (tree *MutableTree) enableFastStorageAndCommit() error {
 // GetImmutable loads an ImmutableTree at a given version for querying. The returned tree is
 // safe for concurrent access, provided the version is not deleted, e.g. via `DeleteVersion()`.
 func (tree *MutableTree) GetImmutable(version int64) (*ImmutableTree, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
 	rootNodeKey, err := tree.ndb.GetRoot(version)
 	if err != nil {
 		return nil, err
@@ -636,9 +955,43 @@ func (tree *MutableTree) GetImmutable(version int64) (*ImmutableTree, error) {
 	}, nil
 }
 
+// LargestLeaves returns the n leaves with the biggest values at the given saved version, see
+// ImmutableTree.LargestLeaves.
+func (tree *MutableTree) LargestLeaves(n int, version int64) ([]LeafInfo, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
+	if !tree.VersionExists(version) {
+		return nil, ErrVersionDoesNotExist
+	}
+	t, err := tree.GetImmutable(version)
+	if err != nil {
+		return nil, err
+	}
+	return t.LargestLeaves(n)
+}
+
+// VersionStats returns the size of the given saved version, see ImmutableTree.Stats.
+func (tree *MutableTree) VersionStats(version int64) (TreeStats, error) {
+	if err := tree.checkOpen(); err != nil {
+		return TreeStats{}, err
+	}
+	if !tree.VersionExists(version) {
+		return TreeStats{}, ErrVersionDoesNotExist
+	}
+	t, err := tree.GetImmutable(version)
+	if err != nil {
+		return TreeStats{}, err
+	}
+	return t.Stats()
+}
+
 // Rollback resets the working tree to the latest saved version, discarding
-// any unsaved modifications.
+// any unsaved modifications. It does nothing once the tree is closed.
 func (tree *MutableTree) Rollback() {
+	if tree.closed.Load() {
+		return
+	}
 	if tree.version > 0 {
 		tree.ImmutableTree = tree.lastSaved.clone()
 	} else {
@@ -652,11 +1005,18 @@ func (tree *MutableTree) Rollback() {
 		tree.unsavedFastNodeAdditions = &sync.Map{}
 		tree.unsavedFastNodeRemovals = &sync.Map{}
 	}
+	tree.unsavedChecksums = nil
+	if err := tree.writeTrace(traceOpRollback); err != nil {
+		tree.logger.Error("failed to trace the rollback", "err", err)
+	}
 }
 
 // GetVersioned gets the value at the specified key and version. The returned value must not be
 // modified, since it may point to data stored within IAVL.
 func (tree *MutableTree) GetVersioned(key []byte, version int64) ([]byte, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
 	if tree.VersionExists(version) {
 		if !tree.skipFastStorageUpgrade {
 			isFastCacheEnabled, err := tree.IsFastCacheEnabled()
@@ -691,7 +1051,17 @@ func (tree *MutableTree) GetVersioned(key []byte, version int64) ([]byte, error)
 // SaveVersion saves a new tree version to disk, based on the current state of
 // the tree. Returns the hash and new version number.
 func (tree *MutableTree) SaveVersion() ([]byte, int64, error) {
+	if err := tree.checkWritable(); err != nil {
+		return nil, 0, err
+	}
 	version := tree.WorkingVersion()
+	span := tree.ndb.startSpan("iavl.SaveVersion")
+	defer span.End()
+	span.SetAttribute("version", version)
+
+	if err := tree.checkUnmodified(); err != nil {
+		return nil, version, err
+	}
 
 	if tree.VersionExists(version) {
 		// If the version already exists, return an error as we're attempting to overwrite.
@@ -715,7 +1085,8 @@ func (tree *MutableTree) SaveVersion() ([]byte, int64, error) {
 			tree.root = existingRoot
 			tree.ImmutableTree = tree.ImmutableTree.clone()
 			tree.lastSaved = tree.ImmutableTree.clone()
-			return newHash, version, nil
+			tree.unsavedChecksums = nil
+			return newHash, version, tree.traceSaveVersion(version, newHash)
 		}
 
 		return nil, version, fmt.Errorf("version %d was already saved to different hash from %X (existing nodeKey %d)", version, newHash, existingNodeKey)
@@ -723,22 +1094,32 @@ func (tree *MutableTree) SaveVersion() ([]byte, int64, error) {
 
 	tree.logger.Debug("SAVE TREE", "version", version)
 
+	timing := &VersionTiming{Version: version}
+	start := time.Now()
+
+	var newNodes []*Node
+	storageVersion := tree.ndb.getStorageVersion()
+	legacyRoot := tree.root != nil && tree.root.nodeKey != nil && tree.root.isLegacy
+	fail := func(err error) ([]byte, int64, error) {
+		return nil, version, tree.revertSaveVersion(version, storageVersion, legacyRoot, newNodes, err)
+	}
+
 	// save new fast nodes
 	if !tree.skipFastStorageUpgrade {
 		if err := tree.saveFastNodeVersion(version); err != nil {
-			return nil, version, err
+			return fail(err)
 		}
 	}
 	// save new nodes
 	if tree.root == nil {
 		if err := tree.ndb.SaveEmptyRoot(version); err != nil {
-			return nil, 0, err
+			return fail(err)
 		}
 	} else {
 		if tree.root.nodeKey != nil {
 			// it means there are no updated nodes
 			if err := tree.ndb.SaveRoot(version, tree.root.nodeKey); err != nil {
-				return nil, 0, err
+				return fail(err)
 			}
 			// it means the reference node is a legacy node
 			if tree.root.isLegacy {
@@ -746,18 +1127,36 @@ func (tree *MutableTree) SaveVersion() ([]byte, int64, error) {
 				// which ensures the reference node is not a legacy node
 				tree.root.isLegacy = false
 				if err := tree.ndb.SaveNode(tree.root); err != nil {
-					return nil, 0, fmt.Errorf("failed to save the reference legacy node: %w", err)
+					return fail(fmt.Errorf("failed to save the reference legacy node: %w", err))
 				}
 			}
 		} else {
-			if err := tree.saveNewNodes(version); err != nil {
-				return nil, 0, err
+			var err error
+			newNodes, err = tree.saveNewNodes(version, timing)
+			if err != nil {
+				return fail(err)
 			}
 		}
 	}
 
+	timing.SaveDuration = time.Since(start) - timing.HashDuration
+	for _, node := range newNodes {
+		timing.Bytes += int64(node.encodedSize())
+	}
+	timing.Nodes = int64(len(newNodes))
+	span.SetAttribute("nodes", timing.Nodes)
+	span.SetAttribute("bytes", timing.Bytes)
+	if tree.ndb.opts.RecordTimings {
+		if err := tree.ndb.SaveVersionTiming(timing); err != nil {
+			return fail(err)
+		}
+	}
+
 	if err := tree.ndb.Commit(); err != nil {
-		return nil, version, err
+		return fail(err)
+	}
+	for _, node := range newNodes {
+		node.leftNode, node.rightNode = nil, nil
 	}
 
 	tree.ndb.resetLatestVersion(version)
@@ -770,8 +1169,85 @@ func (tree *MutableTree) SaveVersion() ([]byte, int64, error) {
 		tree.unsavedFastNodeAdditions = &sync.Map{}
 		tree.unsavedFastNodeRemovals = &sync.Map{}
 	}
+	tree.unsavedChecksums = nil
 
-	return tree.Hash(), version, nil
+	return tree.Hash(), version, tree.traceSaveVersion(version, tree.Hash())
+}
+
+// revertSaveVersion restores the working tree after a failed SaveVersion, so that SaveVersion can be
+// retried and commits the same hash as if no failure occurred. The staged batch is discarded, what
+// was already flushed to disk is reverted and the new nodes get their node keys unassigned. The
+// unsaved fast node changes are retained, so the retry rewrites them all. It returns the cause of
+// the failure, along with any error hit while reverting.
+func (tree *MutableTree) revertSaveVersion(version int64, storageVersion string, legacyRoot bool, newNodes []*Node, cause error) error {
+	for _, node := range newNodes {
+		tree.ndb.uncacheNode(node.GetKey())
+		node.nodeKey = nil
+	}
+	if legacyRoot {
+		tree.ndb.uncacheNode(tree.root.nodeKey.GetKey())
+		tree.root.isLegacy = true
+	}
+	tree.ndb.resetStorageVersion(storageVersion)
+
+	if err := tree.discardSaveVersion(version, storageVersion, legacyRoot); err != nil {
+		return fmt.Errorf("%w; failed to discard the partially written version %d: %v", cause, version, err)
+	}
+	return cause
+}
+
+// discardSaveVersion deletes what a failed SaveVersion may have flushed to disk: the nodes of the
+// version and the legacy root saved again in the new format. The fast nodes and the storage
+// version are restored to the last saved version.
+func (tree *MutableTree) discardSaveVersion(version int64, storageVersion string, legacyRoot bool) error {
+	if err := tree.ndb.discardVersion(version); err != nil {
+		return err
+	}
+	if legacyRoot {
+		if err := tree.ndb.deleteNode(tree.root.nodeKey.GetKey()); err != nil {
+			return err
+		}
+	}
+	if !tree.skipFastStorageUpgrade {
+		keys := make([][]byte, 0)
+		for key := range tree.getUnsavedFastNodeAdditions() {
+			keys = append(keys, []byte(key))
+		}
+		for key := range tree.getUnsavedFastNodeRemovals() {
+			keys = append(keys, []byte(key))
+		}
+		for _, key := range keys {
+			if err := tree.restoreFastNode(key); err != nil {
+				return err
+			}
+		}
+		if err := tree.ndb.restoreStorageVersion(storageVersion); err != nil {
+			return err
+		}
+	}
+	return tree.ndb.Commit()
+}
+
+// restoreFastNode stages the fast node of the key back to its leaf in the last saved version, or
+// its deletion if the key did not exist.
+func (tree *MutableTree) restoreFastNode(key []byte) error {
+	var err error
+	node := tree.lastSaved.root
+	for node != nil && !node.isLeaf() {
+		if bytes.Compare(key, node.key) < 0 {
+			node, err = node.getLeftNode(tree.lastSaved)
+		} else {
+			node, err = node.getRightNode(tree.lastSaved)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if node == nil || !bytes.Equal(node.key, key) {
+		return tree.ndb.DeleteFastNode(key)
+	}
+	tree.ndb.uncacheFastNode(key)
+	return tree.ndb.SaveFastNodeNoCache(fastnode.NewNode(key, node.value, node.nodeKey.version))
 }
 
 func (tree *MutableTree) saveFastNodeVersion(latestVersion int64) error {
@@ -861,6 +1337,9 @@ func (tree *MutableTree) SetInitialVersion(version uint64) {
 // DeleteVersionsTo removes versions upto the given version from the MutableTree.
 // It will not block the SaveVersion() call, instead it will be queued and executed deferred.
 func (tree *MutableTree) DeleteVersionsTo(toVersion int64) error {
+	if err := tree.checkWritable(); err != nil {
+		return err
+	}
 	if err := tree.ndb.DeleteVersionsTo(toVersion); err != nil {
 		return err
 	}
@@ -1002,9 +1481,15 @@ func (tree *MutableTree) balance(node *Node) (newSelf *Node, err error) {
 }
 
 // saveNewNodes save new created nodes by the changes of the working tree.
-// NOTE: This function clears leftNode/rigthNode recursively and
-// calls _hash() on the given node.
-func (tree *MutableTree) saveNewNodes(version int64) error {
+// It returns the nodes which were assigned a node key, also on failure, so that they can be
+// reverted. The caller clears their leftNode/rightNode once the version is committed. The time
+// spent assigning node keys and hashing is recorded in timing.
+//
+// The layout is deterministic: nonces are assigned in pre-order and the nodes are written to
+// the batch in post-order, so that applying the same changes to the same tree always produces
+// byte-identical node records, regardless of the process or machine.
+// NOTE: This function calls _hash() on the given node.
+func (tree *MutableTree) saveNewNodes(version int64, timing *VersionTiming) ([]*Node, error) {
 	nonce := uint32(0)
 	newNodes := make([]*Node, 0)
 	var recursiveAssignKey func(*Node) ([]byte, error)
@@ -1040,17 +1525,55 @@ func (tree *MutableTree) saveNewNodes(version int64) error {
 		return node.nodeKey.GetKey(), nil
 	}
 
+	start := time.Now()
 	if _, err := recursiveAssignKey(tree.root); err != nil {
-		return err
+		return newNodes, err
 	}
+	timing.HashDuration = time.Since(start)
 
 	for _, node := range newNodes {
 		if err := tree.ndb.SaveNode(node); err != nil {
-			return err
+			return newNodes, err
 		}
-		node.leftNode, node.rightNode = nil, nil
 	}
 
+	return newNodes, nil
+}
+
+// SetMany applies the given sets and removals to the working tree, with the same final state
+// and hash as applying them in order. Consecutive sets of a key, with no removal of it in
+// between, only rewrite its path once: the first one is applied with the value of the last one.
+// Updating an existing key does not change the shape of the tree, so this preserves the hash,
+// while removals are all applied at their original position.
+func (tree *MutableTree) SetMany(pairs []*KVPair) error {
+	ops := make([]KVPair, 0, len(pairs))
+	// the position in ops of the pending set of each key, since its last removal
+	pending := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		if pair.Delete {
+			delete(pending, string(pair.Key))
+			ops = append(ops, *pair)
+			continue
+		}
+		if i, ok := pending[string(pair.Key)]; ok {
+			ops[i].Value = pair.Value
+			continue
+		}
+		pending[string(pair.Key)] = len(ops)
+		ops = append(ops, *pair)
+	}
+
+	for _, op := range ops {
+		if op.Delete {
+			if _, _, err := tree.Remove(op.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tree.Set(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1080,12 +1603,38 @@ func (tree *MutableTree) SaveChangeSet(cs *ChangeSet) (int64, error) {
 	return version, err
 }
 
-// Close closes the tree.
+// ComputeRootHash returns the root hash a fresh tree would commit to after applying the given
+// pairs in order, without persisting anything. The pairs are applied to a throwaway in-memory
+// tree which is saved once, so the hash is identical to the one returned by SaveVersion for
+// the same input and options (e.g. InitialVersionOption).
+func ComputeRootHash(pairs []*KVPair, options ...Option) ([]byte, error) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, true, log.NewNopLogger(), options...)
+	for _, pair := range pairs {
+		if pair.Delete {
+			if _, _, err := tree.Remove(pair.Key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := tree.Set(pair.Key, pair.Value); err != nil {
+			return nil, err
+		}
+	}
+	hash, _, err := tree.SaveVersion()
+	return hash, err
+}
+
+// Close closes the tree. Subsequent loads, reads and mutations return ErrTreeClosed, while the
+// methods returning no error see an empty tree. The underlying database is left open, since it
+// may be shared with other trees.
 func (tree *MutableTree) Close() error {
 	tree.mtx.Lock()
 	defer tree.mtx.Unlock()
 
-	tree.ImmutableTree = nil
-	tree.lastSaved = nil
+	tree.closed.Store(true)
+	// release the nodes, keeping empty trees for the methods which cannot report the closing
+	empty := &ImmutableTree{ndb: tree.ndb, skipFastStorageUpgrade: tree.skipFastStorageUpgrade}
+	tree.ImmutableTree = empty
+	tree.lastSaved = empty.clone()
 	return tree.ndb.Close()
 }
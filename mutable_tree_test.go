@@ -2,6 +2,7 @@ package iavl
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/cosmos/iavl/internal/encoding"
 	iavlrand "github.com/cosmos/iavl/internal/rand"
+	"github.com/cosmos/iavl/internal/testutil"
 	"github.com/cosmos/iavl/mock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -255,6 +257,73 @@ func TestMutableTree_LoadVersion_Empty(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestMutableTree_LatestFirstVersion(t *testing.T) {
+	memDB := dbm.NewMemDB()
+	tree := NewMutableTree(memDB, 0, false, log.NewNopLogger(), InitialVersionOption(5))
+	latest, err := tree.LatestVersion()
+	require.NoError(t, err)
+	require.Zero(t, latest)
+	first, err := tree.FirstVersion()
+	require.NoError(t, err)
+	require.Zero(t, first)
+
+	for i := 0; i < 5; i++ {
+		_, err := tree.Set([]byte{byte(i)}, []byte{byte(i)})
+		require.NoError(t, err)
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	require.NoError(t, tree.DeleteVersionsTo(6))
+
+	// a new tree reports the saved versions before loading any
+	tree = NewMutableTree(memDB, 0, false, log.NewNopLogger())
+	latest, err = tree.LatestVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 9, latest)
+	first, err = tree.FirstVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 7, first)
+	require.Zero(t, tree.Version())
+}
+
+func TestMutableTree_PruneLeafRoot(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	// the root of version 1 is a leaf, which stays a child of the roots of the next versions
+	for i := 0; i < 4; i++ {
+		_, err := tree.Set([]byte{byte(i)}, []byte{byte(i)})
+		require.NoError(t, err)
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	require.NoError(t, tree.DeleteVersionsTo(1))
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	first, err := tree.FirstVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, first)
+	require.False(t, tree.VersionExists(1))
+	require.Equal(t, []int{2, 3, 4}, tree.AvailableVersions())
+	_, err = tree.LoadVersion(2)
+	require.NoError(t, err)
+	value, err := tree.Get([]byte{0})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, value)
+
+	// once the leaf is orphaned, pruning deletes it
+	_, err = tree.Load()
+	require.NoError(t, err)
+	_, err = tree.Set([]byte{0}, []byte("updated"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	require.NoError(t, tree.DeleteVersionsTo(4))
+	itr, err := db.Iterator(nodeKeyPrefixFormat.KeyInt64(int64(1)), nodeKeyPrefixFormat.KeyInt64(int64(2)))
+	require.NoError(t, err)
+	require.False(t, itr.Valid())
+	require.NoError(t, itr.Close())
+}
+
 func TestMutableTree_InitialVersion(t *testing.T) {
 	memDB := dbm.NewMemDB()
 	tree := NewMutableTree(memDB, 0, false, log.NewNopLogger(), InitialVersionOption(9))
@@ -1450,3 +1519,835 @@ func TestMutableTreeClose(t *testing.T) {
 
 	require.NoError(t, tree.Close())
 }
+
+func TestComputeRootHash(t *testing.T) {
+	pairs := []*KVPair{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Value: []byte("2")},
+		{Key: []byte("c"), Value: []byte("3")},
+		{Key: []byte("b"), Delete: true},
+		{Key: []byte("a"), Value: []byte("4")},
+	}
+
+	for _, initialVersion := range []uint64{0, 100} {
+		tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), InitialVersionOption(initialVersion))
+		_, err := tree.SaveChangeSet(&ChangeSet{Pairs: pairs})
+		require.NoError(t, err)
+
+		hash, err := ComputeRootHash(pairs, InitialVersionOption(initialVersion))
+		require.NoError(t, err)
+		require.Equal(t, tree.Hash(), hash)
+	}
+
+	hash, err := ComputeRootHash(nil)
+	require.NoError(t, err)
+	require.Equal(t, setupMutableTree(false).WorkingHash(), hash)
+}
+
+func TestMutableTree_SaveVersionEmpty(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+
+	hash, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), version)
+	require.Equal(t, sha256.New().Sum(nil), hash)
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	_, err = tree.Load()
+	require.NoError(t, err)
+	require.Nil(t, tree.root)
+	require.Equal(t, hash, tree.Hash())
+}
+
+func TestMutableTree_SaveVersionSingleLeaf(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+
+	_, err := tree.Set([]byte("key"), []byte("value"))
+	require.NoError(t, err)
+	require.True(t, tree.root.isLeaf())
+	workingHash := tree.WorkingHash()
+
+	hash, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), version)
+
+	// the root is the leaf itself, hashed as a leaf of the committed version
+	expected := NewNode([]byte("key"), []byte("value"))._hash(version)
+	require.Equal(t, expected, hash)
+	require.Equal(t, workingHash, hash)
+	require.Equal(t, GetRootKey(version), tree.root.GetKey())
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	_, err = tree.Load()
+	require.NoError(t, err)
+	require.True(t, tree.root.isLeaf())
+	require.Equal(t, hash, tree.Hash())
+	value, err := tree.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+}
+
+func TestMutableTree_KeyValidator(t *testing.T) {
+	errKeyTooLong := errors.New("key too long")
+	validator := func(key []byte) error {
+		if len(key) > 4 {
+			return errKeyTooLong
+		}
+		return nil
+	}
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), KeyValidatorOption(validator))
+
+	_, err := tree.Set([]byte("key"), []byte("value"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	hash := tree.WorkingHash()
+
+	_, err = tree.Set([]byte("too long"), []byte("value"))
+	require.ErrorIs(t, err, errKeyTooLong)
+	_, removed, err := tree.Remove([]byte("too long"))
+	require.ErrorIs(t, err, errKeyTooLong)
+	require.False(t, removed)
+
+	// the rejected calls left the tree untouched
+	require.Equal(t, hash, tree.WorkingHash())
+	require.Equal(t, int64(1), tree.Size())
+	require.Empty(t, tree.getUnsavedFastNodeAdditions())
+	require.Empty(t, tree.getUnsavedFastNodeRemovals())
+
+	_, removed, err = tree.Remove([]byte("key"))
+	require.NoError(t, err)
+	require.True(t, removed)
+}
+
+// flakyDB fails the failAt-th write of its batches, counting from 1.
+type flakyDB struct {
+	dbm.DB
+	writes int
+	failAt int
+}
+
+func (db *flakyDB) NewBatch() dbm.Batch {
+	return &flakyBatch{Batch: db.DB.NewBatch(), db: db}
+}
+
+func (db *flakyDB) NewBatchWithSize(size int) dbm.Batch {
+	return &flakyBatch{Batch: db.DB.NewBatchWithSize(size), db: db}
+}
+
+type flakyBatch struct {
+	dbm.Batch
+	db *flakyDB
+}
+
+func (b *flakyBatch) Write() error {
+	b.db.writes++
+	if b.db.writes == b.db.failAt {
+		return errors.New("injected write failure")
+	}
+	return b.Batch.Write()
+}
+
+func (b *flakyBatch) WriteSync() error {
+	return b.Write()
+}
+
+func dumpDB(t *testing.T, db dbm.DB) map[string]string {
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	kvs := map[string]string{}
+	for ; itr.Valid(); itr.Next() {
+		kvs[string(itr.Key())] = string(itr.Value())
+	}
+	require.NoError(t, itr.Error())
+	return kvs
+}
+
+func TestMutableTree_SaveVersionRetry(t *testing.T) {
+	testCases := map[string]struct {
+		flushThreshold int
+		failAfter      int // successful writes during the failing SaveVersion
+	}{
+		"fail on commit":   {flushThreshold: 100000, failAfter: 0},
+		"fail after flush": {flushThreshold: 2000, failAfter: 2},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			refDB := dbm.NewMemDB()
+			db := &flakyDB{DB: dbm.NewMemDB()}
+			ref := NewMutableTree(refDB, 0, false, log.NewNopLogger(), FlushThresholdOption(tc.flushThreshold))
+			tree := NewMutableTree(db, 0, false, log.NewNopLogger(), FlushThresholdOption(tc.flushThreshold))
+
+			apply := func(version int) {
+				for i := 0; i < 200; i++ {
+					key := []byte(fmt.Sprintf("key-%03d", (i*7+version)%250))
+					value := []byte(fmt.Sprintf("value-%d-%d", version, i))
+					_, err := ref.Set(key, value)
+					require.NoError(t, err)
+					_, err = tree.Set(key, value)
+					require.NoError(t, err)
+				}
+				for i := 0; i < 20; i++ {
+					key := []byte(fmt.Sprintf("key-%03d", i*11+version))
+					_, _, err := ref.Remove(key)
+					require.NoError(t, err)
+					_, _, err = tree.Remove(key)
+					require.NoError(t, err)
+				}
+			}
+
+			apply(1)
+			_, _, err := ref.SaveVersion()
+			require.NoError(t, err)
+			_, _, err = tree.SaveVersion()
+			require.NoError(t, err)
+
+			apply(2)
+			expected, _, err := ref.SaveVersion()
+			require.NoError(t, err)
+
+			db.failAt = db.writes + tc.failAfter + 1
+			_, _, err = tree.SaveVersion()
+			require.Error(t, err)
+			require.Equal(t, int64(1), tree.Version())
+
+			hash, version, err := tree.SaveVersion()
+			require.NoError(t, err)
+			require.Equal(t, int64(2), version)
+			require.Equal(t, expected, hash)
+			require.Equal(t, dumpDB(t, refDB), dumpDB(t, db))
+
+			reloaded := NewMutableTree(db, 0, false, log.NewNopLogger())
+			_, err = reloaded.Load()
+			require.NoError(t, err)
+			require.Equal(t, expected, reloaded.Hash())
+		})
+	}
+}
+
+func TestMutableTree_ReadOnlyLowMem(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 1000, false, log.NewNopLogger())
+	for i := 0; i < 500; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		require.NoError(t, err)
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	reader := NewMutableTree(db, 1000, false, log.NewNopLogger(), ReadOnlyLowMemOption(true))
+	_, err = reader.Load()
+	require.NoError(t, err)
+	require.Equal(t, tree.Hash(), reader.Hash())
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 500; i++ {
+			value, err := reader.Get([]byte(fmt.Sprintf("key-%03d", i)))
+			require.NoError(t, err)
+			require.Equal(t, []byte(fmt.Sprintf("value-%d", i)), value)
+		}
+		has, err := reader.Has([]byte("missing"))
+		require.NoError(t, err)
+		require.False(t, has)
+
+		itr, err := reader.Iterator(nil, nil, true)
+		require.NoError(t, err)
+		count := 0
+		for ; itr.Valid(); itr.Next() {
+			count++
+		}
+		require.NoError(t, itr.Close())
+		require.Equal(t, 500, count)
+	}
+	require.Zero(t, reader.ndb.nodeCache.Len())
+	require.Zero(t, reader.ndb.fastNodeCache.Len())
+
+	_, err = reader.Set([]byte("key"), []byte("value"))
+	require.ErrorIs(t, err, ErrReadOnly)
+	_, _, err = reader.Remove([]byte("key-000"))
+	require.ErrorIs(t, err, ErrReadOnly)
+	_, _, err = reader.SaveVersion()
+	require.ErrorIs(t, err, ErrReadOnly)
+	require.ErrorIs(t, reader.DeleteVersionsTo(1), ErrReadOnly)
+}
+
+func TestMutableTree_Closed(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	_, err := tree.Set([]byte("key"), []byte("value"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	require.NoError(t, tree.Close())
+
+	_, err = tree.Set([]byte("key"), []byte("value"))
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, _, err = tree.Remove([]byte("key"))
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, _, err = tree.SaveVersion()
+	require.ErrorIs(t, err, ErrTreeClosed)
+	require.ErrorIs(t, tree.DeleteVersionsTo(1), ErrTreeClosed)
+	require.ErrorIs(t, tree.SetMany([]*KVPair{NewKVPair([]byte("key"), []byte("value"))}), ErrTreeClosed)
+	_, err = tree.Import(2)
+	require.ErrorIs(t, err, ErrTreeClosed)
+	require.ErrorIs(t, tree.LoadVersionForOverwriting(1), ErrTreeClosed)
+
+	// reads report the closing too, rather than dereferencing the released trees
+	_, err = tree.Get([]byte("key"))
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.Has([]byte("key"))
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.Iterator(nil, nil, true)
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.Iterate(func(_, _ []byte) bool { return false })
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.GetImmutable(1)
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.GetVersioned([]byte("key"), 1)
+	require.ErrorIs(t, err, ErrTreeClosed)
+	require.ErrorIs(t, tree.VerifyPersisted(), ErrTreeClosed)
+	require.False(t, tree.VersionExists(1))
+	require.NotPanics(t, func() {
+		tree.Hash()
+		tree.WorkingHash()
+		tree.Size()
+	})
+
+	// reloading does not reopen the tree
+	_, err = tree.Load()
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, err = tree.LoadVersion(1)
+	require.ErrorIs(t, err, ErrTreeClosed)
+	tree.Rollback()
+	_, err = tree.Set([]byte("key"), []byte("other"))
+	require.ErrorIs(t, err, ErrTreeClosed)
+	_, _, err = tree.SaveVersion()
+	require.ErrorIs(t, err, ErrTreeClosed)
+}
+
+func TestMutableTree_VersionGaps(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	for version := 1; version <= 10; version++ {
+		// rewrite every leaf, so that no version shares nodes with another one
+		for i := 0; i < 20; i++ {
+			_, err := tree.Set([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%d-%d", version, i)))
+			require.NoError(t, err)
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	gaps, err := tree.VersionGaps()
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+
+	// drop versions 4 to 6 and 9, as an incomplete restore would
+	for _, r := range [][2]int64{{4, 7}, {9, 10}} {
+		itr, err := db.Iterator(nodeKeyPrefixFormat.KeyInt64(r[0]), nodeKeyPrefixFormat.KeyInt64(r[1]))
+		require.NoError(t, err)
+		var keys [][]byte
+		for ; itr.Valid(); itr.Next() {
+			keys = append(keys, itr.Key())
+		}
+		require.NoError(t, itr.Close())
+		for _, key := range keys {
+			require.NoError(t, db.Delete(key))
+		}
+	}
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	gaps, err = tree.VersionGaps()
+	require.NoError(t, err)
+	require.Equal(t, [][2]int64{{4, 6}, {9, 9}}, gaps)
+	require.Equal(t, []int{1, 2, 3, 7, 8, 10}, tree.AvailableVersions())
+	first, err := tree.FirstVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, first)
+	require.False(t, tree.VersionExists(5))
+	require.True(t, tree.VersionExists(7))
+
+	_, err = tree.LoadVersion(5)
+	require.ErrorIs(t, err, ErrVersionInGap)
+	require.ErrorIs(t, err, ErrVersionDoesNotExist)
+	require.Contains(t, err.Error(), "closest available versions are 3 and 7")
+
+	_, err = tree.LoadVersion(9)
+	require.ErrorIs(t, err, ErrVersionInGap)
+	require.Contains(t, err.Error(), "closest available versions are 8 and 10")
+
+	_, err = tree.LoadVersion(7)
+	require.NoError(t, err)
+	value, err := tree.Get([]byte("key-03"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value-7-3"), value)
+}
+
+func TestMutableTree_VerifyLeafCount(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	for i := 0; i < 50; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%02d", i)), []byte("value"))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.NoError(t, tree.VerifyLeafCount(version))
+
+	// delete a leaf behind the tree's back, as a truncated import would
+	leaves, err := tree.ndb.leafNodes()
+	require.NoError(t, err)
+	require.NoError(t, db.Delete(tree.ndb.nodeKey(leaves[0].GetKey())))
+
+	err = tree.VerifyLeafCount(version)
+	require.EqualError(t, err, fmt.Sprintf("version %d has 50 leaves according to its root, but 49 are stored", version))
+
+	require.ErrorIs(t, tree.VerifyLeafCount(version+1), ErrVersionDoesNotExist)
+}
+
+func TestMutableTree_DeterministicLayout(t *testing.T) {
+	build := func() dbm.DB {
+		db := dbm.NewMemDB()
+		tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+		r := iavlrand.NewRand()
+		r.Seed(42)
+		for version := 0; version < 5; version++ {
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("key-%03d", r.Intn(200)))
+				if r.Intn(4) == 0 {
+					_, _, err := tree.Remove(key)
+					require.NoError(t, err)
+					continue
+				}
+				_, err := tree.Set(key, r.Bytes(8))
+				require.NoError(t, err)
+			}
+			_, _, err := tree.SaveVersion()
+			require.NoError(t, err)
+		}
+		return db
+	}
+
+	records := func(db dbm.DB) (keys, values [][]byte) {
+		itr, err := db.Iterator(nil, nil)
+		require.NoError(t, err)
+		defer itr.Close()
+		for ; itr.Valid(); itr.Next() {
+			keys = append(keys, itr.Key())
+			values = append(values, itr.Value())
+		}
+		return keys, values
+	}
+
+	keys1, values1 := records(build())
+	keys2, values2 := records(build())
+	require.NotEmpty(t, keys1)
+	require.Equal(t, keys1, keys2)
+	require.Equal(t, values1, values2)
+}
+
+func TestMutableTree_ReleaseMemory(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 10000, false, log.NewNopLogger())
+	for i := 0; i < 500; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i)))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	_, err = tree.Set([]byte("unsaved"), []byte("value"))
+	require.NoError(t, err)
+
+	itree, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+	for i := 0; i < 500; i++ {
+		_, _, err := itree.GetWithIndex([]byte(fmt.Sprintf("key-%03d", i)))
+		require.NoError(t, err)
+	}
+	require.Greater(t, tree.ndb.nodeCache.Len(), 500)
+
+	tree.ReleaseMemory()
+	require.Zero(t, tree.ndb.nodeCache.Len())
+	require.Zero(t, tree.ndb.fastNodeCache.Len())
+
+	for i := 0; i < 500; i++ {
+		value, err := itree.Get([]byte(fmt.Sprintf("key-%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value-%03d", i)), value)
+	}
+	value, err := tree.Get([]byte("unsaved"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+}
+
+func TestMutableTree_SetMany(t *testing.T) {
+	var pairs []*KVPair
+	for i := 0; i < 100; i++ {
+		pairs = append(pairs, NewKVPair([]byte(fmt.Sprintf("key-%02d", i%10)), []byte(fmt.Sprintf("value-%d", i))))
+		pairs = append(pairs, NewKVPair([]byte("hot"), []byte(fmt.Sprintf("hot-%d", i))))
+	}
+
+	apply := func(tree *MutableTree, pairs []*KVPair) {
+		for _, pair := range pairs {
+			if pair.Delete {
+				_, _, err := tree.Remove(pair.Key)
+				require.NoError(t, err)
+				continue
+			}
+			_, err := tree.Set(pair.Key, pair.Value)
+			require.NoError(t, err)
+		}
+	}
+
+	naive := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	apply(naive, pairs)
+	naiveHash, _, err := naive.SaveVersion()
+	require.NoError(t, err)
+
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	require.NoError(t, tree.SetMany(pairs))
+	hash, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.Equal(t, naiveHash, hash)
+
+	value, err := tree.Get([]byte("hot"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("hot-99"), value)
+	value, err = tree.Get([]byte("key-09"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value-99"), value)
+
+	// with removals, the hash matches as well
+	pairs = []*KVPair{
+		NewKVPair([]byte("new"), []byte("1")),
+		NewKVDelete([]byte("hot")),
+		NewKVDelete([]byte("new")),
+		NewKVPair([]byte("hot"), []byte("again")),
+		NewKVPair([]byte("hot"), []byte("last")),
+		NewKVDelete([]byte("key-03")),
+	}
+	apply(naive, pairs)
+	naiveHash, _, err = naive.SaveVersion()
+	require.NoError(t, err)
+	require.NoError(t, tree.SetMany(pairs))
+	hash, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	require.Equal(t, naiveHash, hash)
+	value, err = tree.Get([]byte("hot"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("last"), value)
+
+	// random batches mixing sets and removals of a few keys
+	r := iavlrand.NewRand()
+	r.Seed(981)
+	for i := 0; i < 500; i++ {
+		pairs = pairs[:0]
+		for j := 0; j < 30; j++ {
+			key := []byte(fmt.Sprintf("key-%02d", r.Intn(15)))
+			if r.Intn(3) == 0 {
+				pairs = append(pairs, NewKVDelete(key))
+			} else {
+				pairs = append(pairs, NewKVPair(key, []byte(fmt.Sprintf("value-%d-%d", i, j))))
+			}
+		}
+		apply(naive, pairs)
+		require.NoError(t, tree.SetMany(pairs))
+		require.Equal(t, naive.WorkingHash(), tree.WorkingHash(), "batch %d", i)
+	}
+}
+
+func TestMutableTree_SetManyClonesLess(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	for i := 0; i < 1000; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%04d", i)), []byte("value"))
+		require.NoError(t, err)
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	var pairs []*KVPair
+	for i := 0; i < 100; i++ {
+		pairs = append(pairs, NewKVPair([]byte("key-0500"), []byte(fmt.Sprintf("hot-%d", i))))
+	}
+
+	// every write clones the path to its key, so the allocations count the cloned nodes
+	allocs := func(apply func(tree *MutableTree) error) float64 {
+		return testing.AllocsPerRun(5, func() {
+			tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+			_, err := tree.Load()
+			require.NoError(t, err)
+			require.NoError(t, apply(tree))
+		})
+	}
+	naive := allocs(func(tree *MutableTree) error {
+		for _, pair := range pairs {
+			if _, err := tree.Set(pair.Key, pair.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	collapsed := allocs(func(tree *MutableTree) error { return tree.SetMany(pairs) })
+	require.Less(t, collapsed*4, naive, "SetMany allocates %v times, in-order sets %v times", collapsed, naive)
+}
+
+func TestMutableTree_VerifyPersisted(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 1000, false, log.NewNopLogger())
+	require.NoError(t, tree.VerifyPersisted())
+	for version := 0; version < 3; version++ {
+		for i := 0; i < 50; i++ {
+			_, err := tree.Set([]byte(fmt.Sprintf("key-%02d", i*(version+1)%70)), []byte(fmt.Sprintf("value-%d", version)))
+			require.NoError(t, err)
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+		require.NoError(t, tree.VerifyPersisted())
+	}
+
+	// overwrite a stored leaf behind the cached one
+	node, err := tree.ndb.GetNode(tree.root.leftNodeKey)
+	require.NoError(t, err)
+	for !node.isLeaf() {
+		node, err = tree.ndb.GetNode(node.rightNodeKey)
+		require.NoError(t, err)
+	}
+	tampered := *node
+	tampered.value = []byte("tampered")
+	var buf bytes.Buffer
+	require.NoError(t, tampered.writeBytes(&buf))
+	require.NoError(t, db.Set(tree.ndb.nodeKey(node.GetKey()), buf.Bytes()))
+
+	err = tree.VerifyPersisted()
+	require.EqualError(t, err, fmt.Sprintf("node %X differs from its stored form in its value", node.GetKey()))
+}
+
+func TestMutableTree_VerifyIntegrity(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	require.ErrorIs(t, tree.VerifyIntegrity(1), ErrVersionDoesNotExist)
+	for i := 0; i < 50; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%02d", i)), []byte("value"))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.NoError(t, tree.VerifyIntegrity(version))
+
+	store := func(node *Node) {
+		var buf bytes.Buffer
+		require.NoError(t, node.writeBytes(&buf))
+		require.NoError(t, db.Set(tree.ndb.nodeKey(node.GetKey()), buf.Bytes()))
+	}
+	reload := func() *MutableTree {
+		tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+		_, err := tree.Load()
+		require.NoError(t, err)
+		return tree
+	}
+
+	// an inner node whose size disagrees with its children
+	inner, err := tree.ndb.GetNode(tree.root.leftNodeKey)
+	require.NoError(t, err)
+	tampered := *inner
+	tampered.size++
+	store(&tampered)
+	err = reload().VerifyIntegrity(version)
+	require.EqualError(t, err, fmt.Sprintf("node %X has size %d, but its children add up to %d",
+		inner.GetKey(), inner.size+1, inner.size))
+	store(inner)
+	require.NoError(t, reload().VerifyIntegrity(version))
+
+	// a leaf whose value no longer matches the hashes above it
+	leaf, err := tree.ndb.GetNode(tree.root.rightNodeKey)
+	require.NoError(t, err)
+	for !leaf.isLeaf() {
+		leaf, err = tree.ndb.GetNode(leaf.leftNodeKey)
+		require.NoError(t, err)
+	}
+	tampered = *leaf
+	tampered.value = []byte("tampered")
+	store(&tampered)
+	require.ErrorContains(t, reload().VerifyIntegrity(version), "but its content hashes to")
+}
+
+func TestMutableTree_SetAliasedKeyValue(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger())
+	var buffers [][]byte
+	for i := 0; i < 20; i++ {
+		// key and value are views of the same buffer, and the key's capacity covers the value
+		buf := []byte(fmt.Sprintf("key%02dvalue%02d", i, i))
+		buffers = append(buffers, buf)
+		_, err := tree.Set(buf[:5], buf[5:])
+		require.NoError(t, err)
+	}
+	_, err := tree.Set(buffers[3][:5], buffers[3][5:])
+	require.NoError(t, err)
+	_, _, err = tree.Remove(buffers[4][:5])
+	require.NoError(t, err)
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	for i, buf := range buffers {
+		require.Equal(t, fmt.Sprintf("key%02dvalue%02d", i, i), string(buf))
+	}
+
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger())
+	_, err = tree.LoadVersion(version)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		value, err := tree.Get([]byte(fmt.Sprintf("key%02d", i)))
+		require.NoError(t, err)
+		if i == 4 {
+			require.Nil(t, value)
+			continue
+		}
+		require.Equal(t, fmt.Sprintf("value%02d", i), string(value))
+	}
+}
+
+// TestMutableTree_AllocBudgets turns allocation regressions on the hot paths into failures. The
+// budgets hold for a 1000 key working tree of height 10, whose path to the key was already
+// rewritten in this version, with the fast index enabled. Each is the measured value plus a
+// margin of one or two allocations.
+func TestMutableTree_AllocBudgets(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 10000, false, log.NewNopLogger())
+	for i := 0; i < 1000; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%04d", i)), []byte("value"))
+		require.NoError(t, err)
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+	key, value := []byte("key-0500"), []byte("other")
+	_, err = tree.Set(key, value)
+	require.NoError(t, err)
+
+	budgets := []struct {
+		name   string
+		budget float64
+		op     func()
+	}{
+		// Served from the unsaved fast node additions, without allocating.
+		{"Get", 0, func() { _, _ = tree.Get(key) }},
+		// Measured 14: a clone of each of the 10 inner nodes on the path, the new leaf, and the
+		// fast node with its sync.Map entry and key string.
+		{"Set", 15, func() { _, _ = tree.Set(key, value) }},
+		// Measured 52: the removal clones the path and boxes the arguments of its debug log at
+		// every level (about 35), records the removed fast node (2), and the Set then rebuilds
+		// the path with a new inner node for the reinserted leaf (15).
+		{"Remove+Set", 54, func() {
+			_, _, _ = tree.Remove(key)
+			_, _ = tree.Set(key, value)
+		}},
+	}
+	for _, b := range budgets {
+		allocs := testutil.MeasureAllocs(b.op)
+		require.LessOrEqual(t, allocs, b.budget, "%s allocates %v times per run, over its budget of %v", b.name, allocs, b.budget)
+	}
+}
+
+func TestMutableTree_DetectMutation(t *testing.T) {
+	for _, detect := range []bool{true, false} {
+		tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), DetectMutationOption(detect))
+		value := []byte("value")
+		_, err := tree.Set([]byte("a"), value)
+		require.NoError(t, err)
+		_, err = tree.Set([]byte("b"), []byte("value"))
+		require.NoError(t, err)
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+
+		// slices given to saved versions are no longer checked
+		value[0] = 'V'
+		removed := []byte("removed")
+		_, err = tree.Set([]byte("c"), removed)
+		require.NoError(t, err)
+		_, _, err = tree.Remove([]byte("c"))
+		require.NoError(t, err)
+		removed[0] = 'R'
+		value = []byte("value")
+		_, err = tree.Set([]byte("d"), value)
+		require.NoError(t, err)
+		value[0] = 'V'
+
+		_, _, err = tree.SaveVersion()
+		if !detect {
+			require.NoError(t, err)
+			continue
+		}
+		require.EqualError(t, err, "the key or value of 64 was modified after Set")
+		value[0] = 'v'
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+}
+
+func TestMutableTree_ConcurrentReadsWhileWriting(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 1000, false, log.NewNopLogger())
+	for i := 0; i < 500; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i)))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	itree, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+
+	read := func() error {
+		for i := 0; i < 500; i++ {
+			key := []byte(fmt.Sprintf("key-%03d", i))
+			value, err := itree.Get(key)
+			if err != nil {
+				return err
+			}
+			if string(value) != fmt.Sprintf("value-%03d", i) {
+				return fmt.Errorf("got %q for %s", value, key)
+			}
+			_, value, err = itree.GetWithIndex(key)
+			if err != nil {
+				return err
+			}
+			if string(value) != fmt.Sprintf("value-%03d", i) {
+				return fmt.Errorf("got %q for %s by index", value, key)
+			}
+		}
+		itr, err := itree.Iterator(nil, nil, true)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for ; itr.Valid(); itr.Next() {
+			count++
+		}
+		if err := itr.Close(); err != nil {
+			return err
+		}
+		if count != 500 {
+			return fmt.Errorf("iterated %d keys", count)
+		}
+		return nil
+	}
+
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		go func() {
+			errs <- read()
+		}()
+	}
+
+	for i := 0; i < 500; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%03d", i)), []byte("updated"))
+		require.NoError(t, err)
+		if i%2 == 0 {
+			_, _, err = tree.Remove([]byte(fmt.Sprintf("key-%03d", i)))
+			require.NoError(t, err)
+		}
+	}
+	for g := 0; g < 4; g++ {
+		require.NoError(t, <-errs)
+	}
+}
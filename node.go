@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 
 	"github.com/cosmos/iavl/cache"
 
@@ -31,6 +32,12 @@ type NodeKey struct {
 	nonce   uint32
 }
 
+// NewNodeKey returns the NodeKey of the node with the given nonce, among the nodes created at
+// the given version. The root of a version has nonce 1.
+func NewNodeKey(version int64, nonce uint32) *NodeKey {
+	return &NodeKey{version: version, nonce: nonce}
+}
+
 // GetKey returns a byte slice of the NodeKey.
 func (nk *NodeKey) GetKey() []byte {
 	b := make([]byte, 12)
@@ -39,6 +46,11 @@ func (nk *NodeKey) GetKey() []byte {
 	return b
 }
 
+// GetStorageKey returns the database key under which the node with the NodeKey is stored.
+func (nk *NodeKey) GetStorageKey() []byte {
+	return nodeKeyFormat.Key(nk.GetKey())
+}
+
 // GetNodeKey returns a NodeKey from a byte slice.
 func GetNodeKey(key []byte) *NodeKey {
 	return &NodeKey{
@@ -311,8 +323,12 @@ func (node *Node) clone(tree *MutableTree) (*Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		node.leftNode = nil
-		node.rightNode = nil
+		// Persisted nodes are shared with iterators and immutable trees of saved
+		// versions, so only write to them when there is something to release.
+		if node.leftNode != nil || node.rightNode != nil {
+			node.leftNode = nil
+			node.rightNode = nil
+		}
 	}
 
 	return &Node{
@@ -421,6 +437,45 @@ func (node *Node) getByIndex(t *ImmutableTree, index int64) (key []byte, value [
 	return rightNode.getByIndex(t, index-leftNode.size)
 }
 
+// getBatch resolves the values of the given keys under the node, keys must be sorted in ascending
+// order. values[i] receives the value of keys[i], or stays nil if the key is missing. Keys falling
+// in the same subtree share the descent into it, so every node is loaded at most once.
+func (node *Node) getBatch(t *ImmutableTree, keys [][]byte, values [][]byte) error {
+	if node.isLeaf() {
+		for i, key := range keys {
+			if bytes.Equal(node.key, key) {
+				values[i] = node.value
+			}
+		}
+		return nil
+	}
+
+	split := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], node.key) >= 0
+	})
+
+	if split > 0 {
+		leftNode, err := node.getLeftNode(t)
+		if err != nil {
+			return err
+		}
+		if err := leftNode.getBatch(t, keys[:split], values[:split]); err != nil {
+			return err
+		}
+	}
+
+	if split < len(keys) {
+		rightNode, err := node.getRightNode(t)
+		if err != nil {
+			return err
+		}
+		if err := rightNode.getBatch(t, keys[split:], values[split:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Computes the hash of the node without computing its descendants. Must be
 // called on nodes which have descendant node hashes already computed.
 func (node *Node) _hash(version int64) []byte {
@@ -7,9 +7,11 @@ import (
 	"math/rand"
 	"testing"
 
+	"cosmossdk.io/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	dbm "github.com/cosmos/iavl/db"
 	iavlrand "github.com/cosmos/iavl/internal/rand"
 )
 
@@ -262,3 +264,19 @@ func BenchmarkNode_HashNode(b *testing.B) {
 		}
 	})
 }
+
+func TestNodeKey_GetStorageKey(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	_, err := tree.Set([]byte("a"), []byte("b"))
+	require.NoError(t, err)
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	nodeKey := NewNodeKey(version, 1)
+	buf, err := tree.ndb.db.Get(nodeKey.GetStorageKey())
+	require.NoError(t, err)
+	node, err := MakeNode(nodeKey.GetKey(), buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), node.key)
+	require.Equal(t, tree.Hash(), node.hash)
+}
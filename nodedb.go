@@ -63,6 +63,9 @@ var (
 	// decide how to parse.
 	metadataKeyFormat = keyformat.NewKeyFormat('m', 0) // m<keystring>
 
+	// Key Format for the per-version commit timings, only written when Options.RecordTimings is set.
+	timingKeyFormat = keyformat.NewKeyFormat('t', int64Size) // t<version>
+
 	// All legacy node keys are prefixed with the byte 'n'.
 	legacyNodeKeyFormat = keyformat.NewFastPrefixFormatter('n', hashSize) // n<hash>
 
@@ -87,6 +90,7 @@ type nodeDB struct {
 	firstVersion        int64            // First version of nodeDB.
 	latestVersion       int64            // Latest version of nodeDB.
 	legacyLatestVersion int64            // Latest version of nodeDB in legacy format.
+	nodeCacheSize       int              // Maximum number of nodes in nodeCache.
 	nodeCache           cache.Cache      // Cache for nodes in the regular tree that consists of key-value pairs at any version.
 	fastNodeCache       cache.Cache      // Cache for nodes in the fast index that represents only key-value pairs at the latest version.
 }
@@ -106,6 +110,7 @@ func newNodeDB(db dbm.DB, cacheSize int, opts Options, lg log.Logger) *nodeDB {
 		firstVersion:        0,
 		latestVersion:       0, // initially invalid
 		legacyLatestVersion: 0,
+		nodeCacheSize:       cacheSize,
 		nodeCache:           cache.New(cacheSize),
 		fastNodeCache:       cache.New(fastNodeCacheSize),
 		versionReaders:      make(map[int64]uint32, 8),
@@ -134,19 +139,58 @@ func (ndb *nodeDB) GetNode(nk []byte) (*Node, error) {
 	ndb.opts.Stat.IncCacheMissCnt()
 
 	// Doesn't exist, load.
-	isLegcyNode := len(nk) == hashSize
-	var nodeKey []byte
-	if isLegcyNode {
-		nodeKey = ndb.legacyNodeKey(nk)
-	} else {
-		nodeKey = ndb.nodeKey(nk)
+	node, err := ndb.loadNode(nk)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ndb.opts.ReadOnlyLowMem {
+		ndb.nodeCache.Add(node)
+	}
+
+	return node, nil
+}
+
+// loadNode reads and decodes a node from disk, bypassing the cache.
+func (ndb *nodeDB) loadNode(nk []byte) (*Node, error) {
+	node, err := ndb.readNode(nk)
+	if err != nil {
+		return nil, err
 	}
-	buf, err := ndb.db.Get(nodeKey)
+	if node == nil {
+		return nil, fmt.Errorf("Value missing for key %v corresponding to nodeKey %x", nk, ndb.storedNodeKey(nk))
+	}
+	return node, nil
+}
+
+// storedNodeKey returns the database key of the node with the given node key or legacy hash.
+func (ndb *nodeDB) storedNodeKey(nk []byte) []byte {
+	if len(nk) == hashSize {
+		return ndb.legacyNodeKey(nk)
+	}
+	return ndb.nodeKey(nk)
+}
+
+// readNode reads and decodes a node from disk, bypassing the cache. It returns nil if the node
+// is missing.
+func (ndb *nodeDB) readNode(nk []byte) (*Node, error) {
+	isLegcyNode := len(nk) == hashSize
+	buf, err := ndb.db.Get(ndb.storedNodeKey(nk))
 	if err != nil {
 		return nil, fmt.Errorf("can't get node %v: %v", nk, err)
 	}
+	if buf == nil && !isLegcyNode {
+		// the root of a pruned version which is still referred to is reformatted to
+		// (version, 0), see deleteVersion
+		if rnk := GetNodeKey(nk); rnk.nonce == 1 {
+			rnk.nonce = 0
+			if buf, err = ndb.db.Get(ndb.nodeKey(rnk.GetKey())); err != nil {
+				return nil, fmt.Errorf("can't get node %v: %v", nk, err)
+			}
+		}
+	}
 	if buf == nil {
-		return nil, fmt.Errorf("Value missing for key %v corresponding to nodeKey %x", nk, nodeKey)
+		return nil, nil
 	}
 
 	var node *Node
@@ -162,8 +206,6 @@ func (ndb *nodeDB) GetNode(nk []byte) (*Node, error) {
 		}
 	}
 
-	ndb.nodeCache.Add(node)
-
 	return node, nil
 }
 
@@ -199,7 +241,9 @@ func (ndb *nodeDB) GetFastNode(key []byte) (*fastnode.Node, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading FastNode. bytes: %x, error: %w", buf, err)
 	}
-	ndb.fastNodeCache.Add(fastNode)
+	if !ndb.opts.ReadOnlyLowMem {
+		ndb.fastNodeCache.Add(fastNode)
+	}
 	return fastNode, nil
 }
 
@@ -277,6 +321,24 @@ func (ndb *nodeDB) getStorageVersion() string {
 	return ndb.storageVersion
 }
 
+func (ndb *nodeDB) resetStorageVersion(storageVersion string) {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	ndb.storageVersion = storageVersion
+}
+
+// restoreStorageVersion stages the given storage version to be written back, in place of the one
+// which SetFastStorageVersionToBatch may have flushed.
+func (ndb *nodeDB) restoreStorageVersion(storageVersion string) error {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	if storageVersion < fastStorageVersionValue {
+		// the default storage version is never written
+		return ndb.batch.Delete(metadataKeyFormat.Key([]byte(storageVersionKey)))
+	}
+	return ndb.batch.Set(metadataKeyFormat.Key([]byte(storageVersionKey)), []byte(storageVersion))
+}
+
 // Returns true if the upgrade to latest storage version has been performed, false otherwise.
 func (ndb *nodeDB) hasUpgradedToFastStorage() bool {
 	return ndb.getStorageVersion() >= fastStorageVersionValue
@@ -330,6 +392,116 @@ func (ndb *nodeDB) Has(nk []byte) (bool, error) {
 	return ndb.db.Has(ndb.nodeKey(nk))
 }
 
+// countStoredLeaves counts the leaves reachable from the given node which are present in the
+// database. Each node is read once from disk, without going through or filling the cache, and
+// missing subtrees are counted as empty.
+func (ndb *nodeDB) countStoredLeaves(nk []byte) (int64, error) {
+	node, err := ndb.readNode(nk)
+	if err != nil || node == nil {
+		return 0, err
+	}
+	if node.isLeaf() {
+		return 1, nil
+	}
+	left, err := ndb.countStoredLeaves(node.leftNodeKey)
+	if err != nil {
+		return 0, err
+	}
+	right, err := ndb.countStoredLeaves(node.rightNodeKey)
+	if err != nil {
+		return 0, err
+	}
+	return left + right, nil
+}
+
+// verifyNode recomputes the hash of the given node from its stored content and the recomputed
+// hashes of its children, and checks its size and height against its children's. It fails on
+// the first node which does not match its stored form, and returns the node otherwise.
+func (ndb *nodeDB) verifyNode(nk []byte) (*Node, error) {
+	node, err := ndb.GetNode(nk)
+	if err != nil {
+		return nil, err
+	}
+	check := &Node{
+		key:           node.key,
+		value:         node.value,
+		size:          node.size,
+		subtreeHeight: node.subtreeHeight,
+	}
+	if node.isLeaf() {
+		if node.size != 1 {
+			return nil, fmt.Errorf("leaf node %X has size %d", nk, node.size)
+		}
+	} else {
+		left, err := ndb.verifyNode(node.leftNodeKey)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ndb.verifyNode(node.rightNodeKey)
+		if err != nil {
+			return nil, err
+		}
+		if size := left.size + right.size; node.size != size {
+			return nil, fmt.Errorf("node %X has size %d, but its children add up to %d", nk, node.size, size)
+		}
+		if height := maxInt8(left.subtreeHeight, right.subtreeHeight) + 1; node.subtreeHeight != height {
+			return nil, fmt.Errorf("node %X has height %d, but its children imply %d", nk, node.subtreeHeight, height)
+		}
+		check.leftNode, check.rightNode = &Node{hash: left.hash}, &Node{hash: right.hash}
+	}
+	hash := check._hash(node.nodeKey.version)
+	if !bytes.Equal(hash, node.hash) {
+		return nil, fmt.Errorf("node %X has hash %X, but its content hashes to %X", nk, node.hash, hash)
+	}
+	return node, nil
+}
+
+// verifyPersisted compares the given node and its descendants, as held in memory, with their
+// stored form. Children are resolved through the cache, like queries do.
+func (ndb *nodeDB) verifyPersisted(node *Node) error {
+	nk := node.GetKey()
+	stored, err := ndb.loadNode(nk)
+	if err != nil {
+		return err
+	}
+	var field string
+	switch {
+	case *stored.nodeKey != *node.nodeKey:
+		field = "node key"
+	case !bytes.Equal(stored.key, node.key):
+		field = "key"
+	case !bytes.Equal(stored.value, node.value):
+		field = "value"
+	case !bytes.Equal(stored.hash, node.hash):
+		field = "hash"
+	case stored.size != node.size:
+		field = "size"
+	case stored.subtreeHeight != node.subtreeHeight:
+		field = "height"
+	case !bytes.Equal(stored.leftNodeKey, node.leftNodeKey):
+		field = "left node key"
+	case !bytes.Equal(stored.rightNodeKey, node.rightNodeKey):
+		field = "right node key"
+	}
+	if field != "" {
+		return fmt.Errorf("node %X differs from its stored form in its %s", nk, field)
+	}
+	if node.isLeaf() {
+		return nil
+	}
+
+	for _, childKey := range [][]byte{node.leftNodeKey, node.rightNodeKey} {
+		child, err := ndb.GetNode(childKey)
+		if err != nil {
+			return err
+		}
+		if err := ndb.verifyPersisted(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // deleteVersion deletes a tree version from disk.
 // deletes orphans
 func (ndb *nodeDB) deleteVersion(version int64) error {
@@ -338,7 +510,12 @@ func (ndb *nodeDB) deleteVersion(version int64) error {
 		return err
 	}
 
+	literalRootKey := GetRootKey(version)
+	rootOrphaned := false
 	if err := ndb.traverseOrphans(version, version+1, func(orphan *Node) error {
+		if !orphan.isLegacy && bytes.Equal(orphan.GetKey(), literalRootKey) {
+			rootOrphaned = true
+		}
 		if orphan.nodeKey.nonce == 0 && !orphan.isLegacy {
 			// if the orphan is a reformatted root, it can be a legacy root
 			// so it should be removed from the pruning process.
@@ -361,32 +538,17 @@ func (ndb *nodeDB) deleteVersion(version int64) error {
 		return err
 	}
 
-	literalRootKey := GetRootKey(version)
 	if rootKey == nil || !bytes.Equal(rootKey, literalRootKey) {
 		// if the root key is not matched with the literal root key, it means the given root
 		// is a reference root to the previous version.
 		if err := ndb.batch.Delete(ndb.nodeKey(literalRootKey)); err != nil {
 			return err
 		}
-	}
-
-	// check if the version is referred by the next version
-	nextRootKey, err := ndb.GetRoot(version + 1)
-	if err != nil {
-		return err
-	}
-	if bytes.Equal(literalRootKey, nextRootKey) {
-		root, err := ndb.GetNode(nextRootKey)
-		if err != nil {
-			return err
-		}
-		// ensure that the given version is not included in the root search
-		if err := ndb.batch.Delete(ndb.nodeKey(literalRootKey)); err != nil {
-			return err
-		}
-		// instead, the root should be reformatted to (version, 0)
-		root.nodeKey.nonce = 0
-		if err := ndb.SaveNode(root); err != nil {
+	} else if !rootOrphaned {
+		// the root is still referred to by the next version, as its root or, for a leaf, as a
+		// child. Reformat it to (version, 0) to keep the given version out of the root search,
+		// loadNode falls back to it.
+		if err := ndb.reformatRoot(version); err != nil {
 			return err
 		}
 	}
@@ -394,6 +556,20 @@ func (ndb *nodeDB) deleteVersion(version int64) error {
 	return nil
 }
 
+// reformatRoot moves the root node of the given version from (version, 1) to (version, 0).
+func (ndb *nodeDB) reformatRoot(version int64) error {
+	literalRootKey := ndb.nodeKey(GetRootKey(version))
+	buf, err := ndb.db.Get(literalRootKey)
+	if err != nil || buf == nil {
+		return err
+	}
+	rnk := &NodeKey{version: version, nonce: 0}
+	if err := ndb.batch.Set(ndb.nodeKey(rnk.GetKey()), buf); err != nil {
+		return err
+	}
+	return ndb.batch.Delete(literalRootKey)
+}
+
 // deleteLegacyNodes deletes all legacy nodes with the given version from disk.
 // NOTE: This is only used for DeleteVersionsFrom.
 func (ndb *nodeDB) deleteLegacyNodes(version int64, nk []byte) error {
@@ -581,6 +757,67 @@ func (ndb *nodeDB) DeleteVersionsTo(toVersion int64) error {
 	return nil
 }
 
+// discardVersion drops the staged batch and stages the deletion of the nodes of the given version
+// which were already flushed to disk. It is used to clean up after a failed SaveVersion, which
+// commits once it staged the rest of its cleanup.
+func (ndb *nodeDB) discardVersion(version int64) error {
+	ndb.mtx.Lock()
+	err := ndb.batch.Close()
+	ndb.batch = NewBatchWithFlusher(ndb.db, ndb.opts.FlushThreshold)
+	ndb.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// collect the keys first, the batch may flush while deleting
+	var keys [][]byte
+	if err := ndb.traverseRange(nodeKeyPrefixFormat.KeyInt64(version), nodeKeyPrefixFormat.KeyInt64(version+1), func(k, _ []byte) error {
+		keys = append(keys, ibytes.Cp(k))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := ndb.batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uncacheNode removes the node with the given node key from the node cache.
+func (ndb *nodeDB) uncacheNode(nk []byte) {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	ndb.nodeCache.Remove(nk)
+}
+
+// uncacheFastNode removes the fast node with the given key from the fast node cache.
+func (ndb *nodeDB) uncacheFastNode(key []byte) {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	ndb.fastNodeCache.Remove(key)
+}
+
+// clearCaches drops every cached node and fast node, so that their memory can be reclaimed.
+func (ndb *nodeDB) clearCaches() {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	ndb.nodeCache = cache.New(ndb.nodeCacheSize)
+	ndb.fastNodeCache = cache.New(fastNodeCacheSize)
+}
+
+// deleteNode stages the deletion of the node with the given node key.
+func (ndb *nodeDB) deleteNode(nk []byte) error {
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	if err := ndb.batch.Delete(ndb.nodeKey(nk)); err != nil {
+		return err
+	}
+	ndb.nodeCache.Remove(nk)
+	return nil
+}
+
 func (ndb *nodeDB) DeleteFastNode(key []byte) error {
 	ndb.mtx.Lock()
 	defer ndb.mtx.Unlock()
@@ -632,22 +869,54 @@ func (ndb *nodeDB) getFirstVersion() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	for firstVersion < latestVersion {
-		version := (latestVersion + firstVersion) >> 1
-		has, err := ndb.hasVersion(version)
-		if err != nil {
-			return 0, err
-		}
-		if has {
-			latestVersion = version
-		} else {
-			firstVersion = version + 1
-		}
+	firstVersion, err = ndb.bisectFirstVersion(latestVersion)
+	if err != nil {
+		return 0, err
+	}
+	if has, err := ndb.hasVersion(firstVersion); err != nil || !has {
+		return 0, err
 	}
 
-	ndb.resetFirstVersion(latestVersion)
+	ndb.resetFirstVersion(firstVersion)
+
+	return firstVersion, nil
+}
 
-	return latestVersion, nil
+// bisectFirstVersion bisects over the root keys for the first version, up to the given one. Gaps
+// left by a partial restore stop the bisection at the first version above one of them, so the
+// versions below are probed at doubling distances, bisecting again below any one found.
+func (ndb *nodeDB) bisectFirstVersion(version int64) (int64, error) {
+	for {
+		low := int64(0)
+		for low < version {
+			mid := low + (version-low)/2
+			has, err := ndb.hasVersion(mid)
+			if err != nil {
+				return 0, err
+			}
+			if has {
+				version = mid
+			} else {
+				low = mid + 1
+			}
+		}
+
+		below := int64(0)
+		for distance := int64(2); distance < version; distance <<= 1 {
+			has, err := ndb.hasVersion(version - distance)
+			if err != nil {
+				return 0, err
+			}
+			if has {
+				below = version - distance
+				break
+			}
+		}
+		if below == 0 {
+			return version, nil
+		}
+		version = below
+	}
 }
 
 func (ndb *nodeDB) resetFirstVersion(version int64) {
@@ -753,6 +1022,116 @@ func (ndb *nodeDB) hasVersion(version int64) (bool, error) {
 	return ndb.db.Has(nodeKeyFormat.Key(GetRootKey(version)))
 }
 
+// traverseVersions calls fn for every available version within [first, last], in ascending order,
+// iterating over the legacy roots and looking up the root key of each later version.
+func (ndb *nodeDB) traverseVersions(first, last int64, fn func(version int64) error) error {
+	legacyLatestVersion, err := ndb.getLegacyLatestVersion()
+	if err != nil {
+		return err
+	}
+	if legacyLatestVersion >= first {
+		if err := ndb.traverseRange(legacyRootKeyFormat.Key(first), legacyRootKeyFormat.Key(legacyLatestVersion+1), func(k, _ []byte) error {
+			var version int64
+			legacyRootKeyFormat.Scan(k, &version)
+			return fn(version)
+		}); err != nil {
+			return err
+		}
+		first = legacyLatestVersion + 1
+	}
+
+	for version := first; version <= last; version++ {
+		has, err := ndb.hasVersion(version)
+		if err != nil {
+			return err
+		}
+		if has {
+			if err := fn(version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// versionGaps returns the inclusive ranges of missing versions between the first and the latest
+// version, across both the legacy and the current root formats.
+func (ndb *nodeDB) versionGaps() ([][2]int64, error) {
+	gaps := [][2]int64{}
+	prev := int64(0)
+	if err := ndb.traverseAvailableVersions(func(version int64) error {
+		if prev > 0 && version > prev+1 {
+			gaps = append(gaps, [2]int64{prev + 1, version - 1})
+		}
+		prev = version
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// versionGapError returns an ErrVersionInGap naming the available versions around the given
+// one, or ErrVersionDoesNotExist if the version is not in a gap.
+func (ndb *nodeDB) versionGapError(version int64) error {
+	firstVersion, err := ndb.getFirstVersion()
+	if err != nil {
+		return err
+	}
+	latestVersion, err := ndb.getLatestVersion()
+	if err != nil {
+		return err
+	}
+	before, err := ndb.closestVersion(version-1, firstVersion, -1)
+	if err != nil {
+		return err
+	}
+	after, err := ndb.closestVersion(version+1, latestVersion, 1)
+	if err != nil {
+		return err
+	}
+	if before == 0 || after == 0 {
+		return ErrVersionDoesNotExist
+	}
+	return fmt.Errorf("%w: version %d is missing, the closest available versions are %d and %d",
+		ErrVersionInGap, version, before, after)
+}
+
+// closestVersion returns the first available version stepping from the given version to the
+// bound, 0 if there is none.
+func (ndb *nodeDB) closestVersion(version, bound, step int64) (int64, error) {
+	for ; (bound-version)*step >= 0; version += step {
+		has, err := ndb.hasVersion(version)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			has, err = ndb.hasLegacyVersion(version)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if has {
+			return version, nil
+		}
+	}
+	return 0, nil
+}
+
+// traverseAvailableVersions calls fn for every available version from the first to the latest
+// one, in ascending order.
+func (ndb *nodeDB) traverseAvailableVersions(fn func(version int64) error) error {
+	firstVersion, err := ndb.getFirstVersion()
+	if err != nil {
+		return err
+	}
+	latestVersion, err := ndb.getLatestVersion()
+	if err != nil {
+		return err
+	}
+	return ndb.traverseVersions(firstVersion, latestVersion, fn)
+}
+
 // hasLegacyVersion checks if the given version exists in the legacy format.
 func (ndb *nodeDB) hasLegacyVersion(version int64) (bool, error) {
 	return ndb.db.Has(ndb.legacyRootKey(version))
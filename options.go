@@ -1,6 +1,9 @@
 package iavl
 
-import "sync/atomic"
+import (
+	"io"
+	"sync/atomic"
+)
 
 // Statisc about db runtime state
 type Statistics struct {
@@ -68,6 +71,27 @@ func (stat *Statistics) Reset() {
 	atomic.StoreUint64(&stat.fastCacheMissCnt, 0)
 }
 
+// Snapshot returns a copy of the current counters, e.g. to be subtracted from later ones with
+// Sub to attribute the cache activity to a block.
+func (stat *Statistics) Snapshot() Statistics {
+	return Statistics{
+		cacheHitCnt:      stat.GetCacheHitCnt(),
+		cacheMissCnt:     stat.GetCacheMissCnt(),
+		fastCacheHitCnt:  stat.GetFastCacheHitCnt(),
+		fastCacheMissCnt: stat.GetFastCacheMissCnt(),
+	}
+}
+
+// Sub returns the counters accumulated since the base snapshot was taken.
+func (stat *Statistics) Sub(base Statistics) Statistics {
+	return Statistics{
+		cacheHitCnt:      stat.GetCacheHitCnt() - base.cacheHitCnt,
+		cacheMissCnt:     stat.GetCacheMissCnt() - base.cacheMissCnt,
+		fastCacheHitCnt:  stat.GetFastCacheHitCnt() - base.fastCacheHitCnt,
+		fastCacheMissCnt: stat.GetFastCacheMissCnt() - base.fastCacheMissCnt,
+	}
+}
+
 // Options define tree options.
 type Options struct {
 	// Sync synchronously flushes all writes to storage, using e.g. the fsync syscall.
@@ -84,6 +108,32 @@ type Options struct {
 
 	// Ethereum has found that commit of 100KB is optimal, ref ethereum/go-ethereum#15115
 	FlushThreshold int
+
+	// RecordTimings persists the commit timings of every saved version, see MutableTree.VersionTimings.
+	RecordTimings bool
+
+	// KeyValidator, when not nil, is consulted by Set and Remove before the tree is touched.
+	// A non-nil error rejects the key and is returned to the caller.
+	KeyValidator func(key []byte) error
+
+	// ReadOnlyLowMem resolves every node directly from storage without caching it, and without
+	// using the fast index, trading query latency for a small and predictable memory footprint.
+	// Trees opened in this mode refuse every mutation with ErrReadOnly.
+	ReadOnlyLowMem bool
+
+	// Tracer, when not nil, creates a span around every Get, Set, Remove and SaveVersion.
+	Tracer Tracer
+
+	// TraceWriter, when not nil, receives a compact binary record of every Set, effective Remove,
+	// Rollback and SaveVersion, in order, so that ReplayTrace can reproduce the exact operation
+	// sequence, including changes overwritten within a version. A failure to write a record is
+	// returned by the operation, which was applied nonetheless, or logged for Rollback.
+	TraceWriter io.Writer
+
+	// DetectMutation is a debugging aid checking the contract that the slices given to Set are not
+	// modified afterwards. Set records a checksum of every key and value, and SaveVersion fails
+	// naming the key if one of them changed, instead of silently committing a corrupted hash.
+	DetectMutation bool
 }
 
 // DefaultOptions returns the default options for IAVL.
@@ -118,3 +168,45 @@ func FlushThresholdOption(ft int) Option {
 		opts.FlushThreshold = ft
 	}
 }
+
+// RecordTimingsOption sets the RecordTimings option.
+func RecordTimingsOption(record bool) Option {
+	return func(opts *Options) {
+		opts.RecordTimings = record
+	}
+}
+
+// ReadOnlyLowMemOption opens the tree in the low-memory read-only mode.
+func ReadOnlyLowMemOption(lowMem bool) Option {
+	return func(opts *Options) {
+		opts.ReadOnlyLowMem = lowMem
+	}
+}
+
+// TracerOption sets the Tracer used to create spans around tree operations.
+func TracerOption(tracer Tracer) Option {
+	return func(opts *Options) {
+		opts.Tracer = tracer
+	}
+}
+
+// TraceWriterOption sets the writer receiving the operation trace replayed by ReplayTrace.
+func TraceWriterOption(w io.Writer) Option {
+	return func(opts *Options) {
+		opts.TraceWriter = w
+	}
+}
+
+// DetectMutationOption enables the detection of keys and values modified after Set.
+func DetectMutationOption(detect bool) Option {
+	return func(opts *Options) {
+		opts.DetectMutation = detect
+	}
+}
+
+// KeyValidatorOption sets the KeyValidator used to reject invalid keys in Set and Remove.
+func KeyValidatorOption(validator func(key []byte) error) Option {
+	return func(opts *Options) {
+		opts.KeyValidator = validator
+	}
+}
@@ -0,0 +1,145 @@
+package iavl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	ics23 "github.com/cosmos/ics23/go"
+
+	dbm "github.com/cosmos/iavl/db"
+)
+
+// CompactProof is the existence proof of a leaf exported by a ProofExporter. Leaves are exported
+// in key order, so consecutive proofs share the inner ops near the root, which are omitted.
+type CompactProof struct {
+	Key   []byte
+	Value []byte
+	Leaf  *ics23.LeafOp
+	// Path holds the inner ops which are not shared with the previous proof, from the leaf up.
+	Path []*ics23.InnerOp
+	// Shared is the number of inner ops at the root end of the previous proof's path which
+	// complete Path.
+	Shared int
+}
+
+// ProofExporter streams the existence proofs of every leaf of an ImmutableTree, in key order. It
+// is created by ImmutableTree.ExportProofs, and the proofs are checked with a ProofVerifier.
+type ProofExporter struct {
+	tree *ImmutableTree
+	itr  dbm.Iterator
+	prev []*ics23.InnerOp
+}
+
+// ExportProofs returns a ProofExporter for the tree, i.e. a verifiable dump of its whole state
+// which is much smaller than one independent proof per key. The exporter must be closed.
+func (t *ImmutableTree) ExportProofs() (*ProofExporter, error) {
+	itr, err := t.Iterator(nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return &ProofExporter{tree: t, itr: itr}, nil
+}
+
+// Next returns the proof of the next leaf, or ErrorExportDone once every leaf was exported.
+func (e *ProofExporter) Next() (*CompactProof, error) {
+	if !e.itr.Valid() {
+		if err := e.itr.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrorExportDone
+	}
+	proof, err := e.tree.createExistenceProof(e.itr.Key())
+	if err != nil {
+		return nil, err
+	}
+	e.itr.Next()
+
+	shared := 0
+	for shared < len(proof.Path) && shared < len(e.prev) &&
+		equalInnerOps(proof.Path[len(proof.Path)-1-shared], e.prev[len(e.prev)-1-shared]) {
+		shared++
+	}
+	e.prev = proof.Path
+	return &CompactProof{
+		Key:    proof.Key,
+		Value:  proof.Value,
+		Leaf:   proof.Leaf,
+		Path:   proof.Path[:len(proof.Path)-shared],
+		Shared: shared,
+	}, nil
+}
+
+// Close closes the exporter.
+func (e *ProofExporter) Close() error {
+	return e.itr.Close()
+}
+
+func equalInnerOps(a, b *ics23.InnerOp) bool {
+	return a.Hash == b.Hash && bytes.Equal(a.Prefix, b.Prefix) && bytes.Equal(a.Suffix, b.Suffix)
+}
+
+// ProofVerifier checks the proofs streamed by a ProofExporter against the root hash of the
+// exported tree, one at a time and in order. Consecutive proofs must be of adjacent leaves, so
+// that no leaf can be dropped from the dump, and Done must be called once the last proof was
+// verified.
+type ProofVerifier struct {
+	root []byte
+	prev *ics23.ExistenceProof
+}
+
+// NewProofVerifier returns a ProofVerifier for the tree with the given root hash.
+func NewProofVerifier(root []byte) *ProofVerifier {
+	return &ProofVerifier{root: root}
+}
+
+// Verify completes the proof with the inner ops shared with the previous one, and checks it
+// against the root hash and that its leaf follows the previous one. It returns the full
+// existence proof.
+func (v *ProofVerifier) Verify(proof *CompactProof) (*ics23.ExistenceProof, error) {
+	var prevPath []*ics23.InnerOp
+	if v.prev != nil {
+		prevPath = v.prev.Path
+	}
+	if proof.Shared < 0 || proof.Shared > len(prevPath) {
+		return nil, fmt.Errorf("proof shares %d inner ops, but the previous one only has %d", proof.Shared, len(prevPath))
+	}
+	path := make([]*ics23.InnerOp, 0, len(proof.Path)+proof.Shared)
+	path = append(path, proof.Path...)
+	path = append(path, prevPath[len(prevPath)-proof.Shared:]...)
+	exist := &ics23.ExistenceProof{
+		Key:   proof.Key,
+		Value: proof.Value,
+		Leaf:  proof.Leaf,
+		Path:  path,
+	}
+	if err := exist.Verify(ics23.IavlSpec, v.root, proof.Key, proof.Value); err != nil {
+		return nil, err
+	}
+
+	spec := ics23.IavlSpec.InnerSpec
+	if v.prev == nil {
+		if !ics23.IsLeftMost(spec, path) {
+			return nil, fmt.Errorf("proof of key %X is not of the first leaf", proof.Key)
+		}
+	} else if !ics23.IsLeftNeighbor(spec, v.prev.Path, path) {
+		return nil, fmt.Errorf("proof of key %X does not follow the one of key %X", proof.Key, v.prev.Key)
+	}
+	v.prev = exist
+	return exist, nil
+}
+
+// Done checks that the last verified proof is of the last leaf, i.e. that the dump is complete.
+func (v *ProofVerifier) Done() error {
+	if v.prev == nil {
+		if !bytes.Equal(v.root, sha256.New().Sum(nil)) {
+			return errors.New("no proof was verified for a non-empty tree")
+		}
+		return nil
+	}
+	if !ics23.IsRightMost(ics23.IavlSpec.InnerSpec, v.prev.Path) {
+		return fmt.Errorf("proof of key %X is not of the last leaf", v.prev.Key)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package iavl
+
+import (
+	"testing"
+
+	ics23 "github.com/cosmos/ics23/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofExporter(t *testing.T) {
+	tree := setupExportTreeSized(t, 500)
+
+	exporter, err := tree.ExportProofs()
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	opsSize := func(ops []*ics23.InnerOp) (size int) {
+		for _, op := range ops {
+			size += len(op.Prefix) + len(op.Suffix)
+		}
+		return size
+	}
+
+	verifier := NewProofVerifier(tree.Hash())
+	var keys [][]byte
+	compactSize, fullSize := 0, 0
+	for {
+		proof, err := exporter.Next()
+		if err == ErrorExportDone {
+			break
+		}
+		require.NoError(t, err)
+		exist, err := verifier.Verify(proof)
+		require.NoError(t, err)
+
+		value, err := tree.Get(proof.Key)
+		require.NoError(t, err)
+		require.Equal(t, value, proof.Value)
+		full, err := tree.GetMembershipProof(proof.Key)
+		require.NoError(t, err)
+		require.Equal(t, full.GetExist(), exist)
+
+		keys = append(keys, proof.Key)
+		compactSize += opsSize(proof.Path)
+		fullSize += opsSize(exist.Path)
+	}
+	require.NoError(t, verifier.Done())
+	require.Len(t, keys, 500)
+	require.Less(t, compactSize, fullSize/3)
+
+	// a proof tampered with, or verified out of order, is rejected
+	exporter, err = tree.ExportProofs()
+	require.NoError(t, err)
+	defer exporter.Close()
+	verifier = NewProofVerifier(tree.Hash())
+	first, err := exporter.Next()
+	require.NoError(t, err)
+	second, err := exporter.Next()
+	require.NoError(t, err)
+	_, err = verifier.Verify(second)
+	require.Error(t, err)
+	first.Value = []byte("tampered")
+	_, err = verifier.Verify(first)
+	require.Error(t, err)
+
+	// so is a dump with a leaf dropped, even with proofs carrying their whole path
+	exporter, err = tree.ExportProofs()
+	require.NoError(t, err)
+	defer exporter.Close()
+	verifier = NewProofVerifier(tree.Hash())
+	var proofs []*CompactProof
+	for {
+		proof, err := exporter.Next()
+		if err == ErrorExportDone {
+			break
+		}
+		require.NoError(t, err)
+		exist, err := verifier.Verify(proof)
+		require.NoError(t, err)
+		proofs = append(proofs, &CompactProof{Key: exist.Key, Value: exist.Value, Leaf: exist.Leaf, Path: exist.Path})
+	}
+	verify := func(proofs []*CompactProof) error {
+		verifier := NewProofVerifier(tree.Hash())
+		for _, proof := range proofs {
+			if _, err := verifier.Verify(proof); err != nil {
+				return err
+			}
+		}
+		return verifier.Done()
+	}
+	require.NoError(t, verify(proofs))
+	require.ErrorContains(t, verify(proofs[1:]), "not of the first leaf")
+	dropped := append(append([]*CompactProof{}, proofs[:250]...), proofs[251:]...)
+	require.ErrorContains(t, verify(dropped), "does not follow")
+	require.ErrorContains(t, verify(proofs[:len(proofs)-1]), "not of the last leaf")
+	require.Error(t, verify(nil))
+}
@@ -201,6 +201,9 @@ func (t *ImmutableTree) VerifyProof(proof *ics23.CommitmentProof, key []byte) (b
 
 // GetVersionedProof gets the proof for the given key at the specified version.
 func (tree *MutableTree) GetVersionedProof(key []byte, version int64) (*ics23.CommitmentProof, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
 	if tree.VersionExists(version) {
 		t, err := tree.GetImmutable(version)
 		if err != nil {
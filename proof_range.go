@@ -0,0 +1,124 @@
+package iavl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	ics23 "github.com/cosmos/ics23/go"
+)
+
+// RangeProof proves that a list of keys is every key of a tree within a range, i.e. that none was
+// omitted. It holds the existence proofs of the returned leaves and of their neighbours just
+// outside of the range, which must all be adjacent in the tree.
+type RangeProof struct {
+	// Left is the proof of the last key before the range, nil if there is none.
+	Left *ics23.ExistenceProof
+	// Leaves are the proofs of the returned keys, in ascending order.
+	Leaves []*ics23.ExistenceProof
+	// Right is the proof of the first key after the returned ones, nil if there is none. Its key
+	// is within the range if the response was truncated by the limit.
+	Right *ics23.ExistenceProof
+}
+
+// GetRangeProof returns the keys and values within [start, end), up to limit of them, along with
+// a RangeProof of their completeness. A nil start or end leaves the range open on that side, and
+// a non-positive limit returns every key in the range. When the response is truncated, the next
+// one can start from proof.Right.Key.
+func (t *ImmutableTree) GetRangeProof(start, end []byte, limit int) (keys, values [][]byte, proof *RangeProof, err error) {
+	if t.root == nil {
+		return nil, nil, nil, fmt.Errorf("cannot generate the proof with nil root")
+	}
+
+	idx := int64(0)
+	if start != nil {
+		idx, _, err = t.GetWithIndex(start)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	proof = &RangeProof{}
+	if idx > 0 {
+		leftKey, _, err := t.GetByIndex(idx - 1)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if proof.Left, err = t.createExistenceProof(leftKey); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	for ; idx < t.root.size; idx++ {
+		key, value, err := t.GetByIndex(idx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		exist, err := t.createExistenceProof(key)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if (end != nil && bytes.Compare(key, end) >= 0) || (limit > 0 && len(keys) == limit) {
+			proof.Right = exist
+			break
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		proof.Leaves = append(proof.Leaves, exist)
+	}
+
+	return keys, values, proof, nil
+}
+
+// Verify checks that keys and values are every entry within [start, end) of the tree with the
+// given root hash, up to proof.Right.Key if the response was truncated.
+func (p *RangeProof) Verify(root, start, end []byte, keys, values [][]byte) error {
+	if len(keys) != len(values) || len(keys) != len(p.Leaves) {
+		return fmt.Errorf("range proof has %d leaves for %d keys and %d values",
+			len(p.Leaves), len(keys), len(values))
+	}
+
+	proofs := make([]*ics23.ExistenceProof, 0, len(p.Leaves)+2)
+	if p.Left != nil {
+		if bytes.Compare(p.Left.Key, start) >= 0 {
+			return fmt.Errorf("left key %X is within the range", p.Left.Key)
+		}
+		proofs = append(proofs, p.Left)
+	}
+	for i, leaf := range p.Leaves {
+		if !bytes.Equal(leaf.Key, keys[i]) || !bytes.Equal(leaf.Value, values[i]) {
+			return fmt.Errorf("range proof leaf %d does not match key %X", i, keys[i])
+		}
+		if bytes.Compare(keys[i], start) < 0 || (end != nil && bytes.Compare(keys[i], end) >= 0) {
+			return fmt.Errorf("key %X is out of the range", keys[i])
+		}
+		proofs = append(proofs, leaf)
+	}
+	if p.Right != nil {
+		proofs = append(proofs, p.Right)
+	}
+	if len(proofs) == 0 {
+		return errors.New("empty range proof")
+	}
+
+	for _, proof := range proofs {
+		if err := proof.Verify(ics23.IavlSpec, root, proof.Key, proof.Value); err != nil {
+			return fmt.Errorf("invalid existence proof for key %X: %w", proof.Key, err)
+		}
+	}
+
+	// adjacent proofs leave no room for an omitted key
+	spec := ics23.IavlSpec.InnerSpec
+	if p.Left == nil && !ics23.IsLeftMost(spec, proofs[0].Path) {
+		return errors.New("range proof is missing the keys before the first one")
+	}
+	for i := 1; i < len(proofs); i++ {
+		if !ics23.IsLeftNeighbor(spec, proofs[i-1].Path, proofs[i].Path) {
+			return fmt.Errorf("range proof is missing the keys between %X and %X", proofs[i-1].Key, proofs[i].Key)
+		}
+	}
+	if p.Right == nil && !ics23.IsRightMost(spec, proofs[len(proofs)-1].Path) {
+		return errors.New("range proof is missing the keys after the last one")
+	}
+	return nil
+}
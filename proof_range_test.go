@@ -0,0 +1,77 @@
+package iavl
+
+import (
+	"fmt"
+	"testing"
+
+	"cosmossdk.io/log"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/cosmos/iavl/db"
+)
+
+func TestRangeProof(t *testing.T) {
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	for i := 0; i < 100; i += 2 {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		require.NoError(t, err)
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+	root := tree.Hash()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%03d", i)) }
+
+	testcases := map[string]struct {
+		start, end []byte
+		limit      int
+		first      int
+		count      int
+	}{
+		"whole tree":       {nil, nil, 0, 0, 50},
+		"open start":       {nil, key(11), 0, 0, 6},
+		"open end":         {key(91), nil, 0, 92, 4},
+		"inner":            {key(10), key(20), 0, 10, 5},
+		"between keys":     {key(11), key(19), 0, 12, 4},
+		"empty":            {key(11), key(12), 0, 0, 0},
+		"before all keys":  {[]byte("a"), []byte("b"), 0, 0, 0},
+		"after all keys":   {[]byte("x"), nil, 0, 0, 0},
+		"limited":          {key(10), key(40), 3, 10, 3},
+		"limit not needed": {key(10), key(16), 3, 10, 3},
+	}
+	for desc, tc := range testcases {
+		tc := tc
+		t.Run(desc, func(t *testing.T) {
+			keys, values, proof, err := tree.GetRangeProof(tc.start, tc.end, tc.limit)
+			require.NoError(t, err)
+			require.Len(t, keys, tc.count)
+			for i := range keys {
+				require.Equal(t, key(tc.first+2*i), keys[i])
+				require.Equal(t, []byte(fmt.Sprintf("value-%d", tc.first+2*i)), values[i])
+			}
+			require.NoError(t, proof.Verify(root, tc.start, tc.end, keys, values))
+			require.Error(t, proof.Verify([]byte("wrong root hash of 32 bytes....."), tc.start, tc.end, keys, values))
+		})
+	}
+
+	keys, values, proof, err := tree.GetRangeProof(key(10), key(20), 0)
+	require.NoError(t, err)
+
+	// a forged response dropping a key inside the range is rejected
+	forged := &RangeProof{Left: proof.Left, Right: proof.Right}
+	forged.Leaves = append(forged.Leaves, proof.Leaves[:2]...)
+	forged.Leaves = append(forged.Leaves, proof.Leaves[3:]...)
+	dropped := func(s [][]byte) [][]byte {
+		return append(append([][]byte{}, s[:2]...), s[3:]...)
+	}
+	require.ErrorContains(t, forged.Verify(root, key(10), key(20), dropped(keys), dropped(values)), "missing the keys")
+
+	// so is one dropping the first or the last key along with its boundary
+	forged = &RangeProof{Left: proof.Left, Leaves: proof.Leaves[:len(proof.Leaves)-1]}
+	require.Error(t, forged.Verify(root, key(10), key(20), keys[:len(keys)-1], values[:len(values)-1]))
+	forged = &RangeProof{Leaves: proof.Leaves[1:], Right: proof.Right}
+	require.Error(t, forged.Verify(root, key(10), key(20), keys[1:], values[1:]))
+
+	// or altering a value
+	values[0] = []byte("forged")
+	require.Error(t, proof.Verify(root, key(10), key(20), keys, values))
+}
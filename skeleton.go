@@ -0,0 +1,76 @@
+package iavl
+
+import "crypto/sha256"
+
+// SkeletonNode is the shape of a node, without its key or value.
+type SkeletonNode struct {
+	NodeKey []byte
+	Height  int8
+	Size    int64
+	// Left and Right are the indexes of the children in Skeleton.Nodes, -1 for leaves.
+	Left  int
+	Right int
+	// KeyHash is the SHA-256 hash of the key of a leaf, nil for inner nodes.
+	KeyHash []byte
+}
+
+// Skeleton is the structure of a tree without its values, for offline analysis of its shape.
+// It is created by ImmutableTree.ExportSkeleton.
+type Skeleton struct {
+	// Nodes are in post-order, so that children come before their parent and the root is last.
+	Nodes []SkeletonNode
+}
+
+// ExportSkeleton returns the skeleton of the tree. Leaf keys are hashed, and values omitted, so
+// that the skeleton is compact and can be shared without exposing the state.
+func (t *ImmutableTree) ExportSkeleton() (*Skeleton, error) {
+	s := &Skeleton{}
+	if t.root == nil {
+		return s, nil
+	}
+	if _, err := s.add(t, t.root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add appends the given node and its descendants in post-order, returning the node's index.
+func (s *Skeleton) add(t *ImmutableTree, node *Node) (int, error) {
+	sn := SkeletonNode{Height: node.subtreeHeight, Size: node.size, Left: -1, Right: -1}
+	if node.nodeKey != nil {
+		sn.NodeKey = node.GetKey()
+	}
+	if node.isLeaf() {
+		hash := sha256.Sum256(node.key)
+		sn.KeyHash = hash[:]
+	} else {
+		leftNode, err := node.getLeftNode(t)
+		if err != nil {
+			return 0, err
+		}
+		if sn.Left, err = s.add(t, leftNode); err != nil {
+			return 0, err
+		}
+		rightNode, err := node.getRightNode(t)
+		if err != nil {
+			return 0, err
+		}
+		if sn.Right, err = s.add(t, rightNode); err != nil {
+			return 0, err
+		}
+	}
+	s.Nodes = append(s.Nodes, sn)
+	return len(s.Nodes) - 1, nil
+}
+
+// Balance returns the number of inner nodes by balance factor, i.e. the height of their left
+// subtree minus the height of their right subtree.
+func (s *Skeleton) Balance() map[int]int {
+	balance := make(map[int]int)
+	for _, sn := range s.Nodes {
+		if sn.Left >= 0 {
+			balance[int(s.Nodes[sn.Left].Height)-int(s.Nodes[sn.Right].Height)]++
+		}
+	}
+	return balance
+}
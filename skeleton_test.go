@@ -0,0 +1,48 @@
+package iavl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSkeleton(t *testing.T) {
+	tree := setupExportTreeSized(t, 1000)
+
+	skeleton, err := tree.ExportSkeleton()
+	require.NoError(t, err)
+	require.Len(t, skeleton.Nodes, 2*1000-1)
+	root := skeleton.Nodes[len(skeleton.Nodes)-1]
+	require.Equal(t, tree.root.subtreeHeight, root.Height)
+	require.EqualValues(t, 1000, root.Size)
+	require.Equal(t, tree.root.GetKey(), root.NodeKey)
+
+	balance := make(map[int]int)
+	leaves := 0
+	tree.root.traverse(tree, true, func(node *Node) bool {
+		if node.isLeaf() {
+			leaves++
+			return false
+		}
+		b, err := node.calcBalance(tree)
+		require.NoError(t, err)
+		balance[b]++
+		return false
+	})
+	require.Equal(t, balance, skeleton.Balance())
+
+	for _, sn := range skeleton.Nodes {
+		if sn.Left < 0 {
+			require.Len(t, sn.KeyHash, 32)
+			leaves--
+			continue
+		}
+		require.Nil(t, sn.KeyHash)
+		require.Equal(t, sn.Size, skeleton.Nodes[sn.Left].Size+skeleton.Nodes[sn.Right].Size)
+	}
+	require.Zero(t, leaves)
+
+	empty, err := (&ImmutableTree{}).ExportSkeleton()
+	require.NoError(t, err)
+	require.Empty(t, empty.Nodes)
+}
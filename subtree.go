@@ -0,0 +1,125 @@
+package iavl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	ibytes "github.com/cosmos/iavl/internal/bytes"
+	"github.com/cosmos/iavl/internal/encoding"
+)
+
+// Subtree is the set of leaves covered by a key prefix, detached from a tree by
+// MutableTree.ExtractSubtree. Its keys are stored relative to the prefix, so it can be
+// grafted into another tree under a different prefix with MutableTree.AttachSubtree.
+type Subtree struct {
+	pairs []*KVPair // ascending by key, prefix stripped
+}
+
+// Size returns the number of leaves in the subtree.
+func (st *Subtree) Size() int {
+	return len(st.pairs)
+}
+
+// Pairs returns the key/value pairs of the subtree, ascending by key. The keys are relative to
+// the prefix the subtree was extracted from. The returned pairs must not be modified.
+func (st *Subtree) Pairs() []*KVPair {
+	return st.pairs
+}
+
+// Hash returns the root hash of a tree holding only the subtree's leaves, independently of
+// where the subtree was extracted from or is attached to.
+func (st *Subtree) Hash() ([]byte, error) {
+	return ComputeRootHash(st.pairs)
+}
+
+// JoinStoreKey prefixes key with the length-prefixed name of its store, for trees holding the
+// keys of several stores. Since the length is encoded, the keys of a store never fall under
+// the prefix of another store whose name starts the same way, and JoinStoreKey(store, nil) is
+// the prefix covering exactly the keys of store, e.g. for ExtractSubtree.
+func JoinStoreKey(store string, key []byte) []byte {
+	full := make([]byte, 0, encoding.EncodeBytesSize([]byte(store))+len(key))
+	full = binary.AppendUvarint(full, uint64(len(store)))
+	full = append(full, store...)
+	return append(full, key...)
+}
+
+// SplitStoreKey splits a key built by JoinStoreKey into its store and key. It returns false if
+// full is malformed or its store is not one of knownStores.
+func SplitStoreKey(full []byte, knownStores []string) (store string, key []byte, ok bool) {
+	name, n, err := encoding.DecodeBytes(full)
+	if err != nil {
+		return "", nil, false
+	}
+	for _, known := range knownStores {
+		if known == string(name) {
+			return known, full[n:], true
+		}
+	}
+	return "", nil, false
+}
+
+// ExtractSubtree removes every key starting with prefix from the working tree and returns
+// them as a Subtree. The tree is rebalanced as keys are removed, like with Remove.
+func (tree *MutableTree) ExtractSubtree(prefix []byte) (*Subtree, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
+	if len(prefix) == 0 {
+		return nil, errors.New("subtree prefix cannot be empty")
+	}
+
+	itr, err := tree.PrefixIterator(prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	st := &Subtree{}
+	for ; itr.Valid(); itr.Next() {
+		st.pairs = append(st.pairs, &KVPair{
+			Key:   ibytes.Cp(itr.Key()[len(prefix):]),
+			Value: ibytes.Cp(itr.Value()),
+		})
+	}
+	if err := itr.Error(); err != nil {
+		itr.Close()
+		return nil, err
+	}
+	if err := itr.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, pair := range st.pairs {
+		if _, _, err := tree.Remove(append(ibytes.Cp(prefix), pair.Key...)); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// AttachSubtree grafts the leaves of st into the working tree under prefix. The range covered
+// by prefix must be empty, so that a subtree moved between trees or prefixes is never merged
+// with unrelated keys.
+func (tree *MutableTree) AttachSubtree(prefix []byte, st *Subtree) error {
+	if len(prefix) == 0 {
+		return errors.New("subtree prefix cannot be empty")
+	}
+
+	itr, err := tree.PrefixIterator(prefix, true)
+	if err != nil {
+		return err
+	}
+	occupied := itr.Valid()
+	if err := itr.Close(); err != nil {
+		return err
+	}
+	if occupied {
+		return fmt.Errorf("cannot attach subtree, keys with prefix %X already exist", prefix)
+	}
+
+	for _, pair := range st.pairs {
+		if _, err := tree.Set(append(ibytes.Cp(prefix), pair.Key...), pair.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
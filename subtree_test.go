@@ -0,0 +1,102 @@
+package iavl
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"cosmossdk.io/log"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/cosmos/iavl/db"
+)
+
+func TestSubtreeRoundTrip(t *testing.T) {
+	src := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	for i := 0; i < 50; i++ {
+		_, err := src.Set([]byte(fmt.Sprintf("bank/%02d", i)), []byte(fmt.Sprintf("balance%d", i)))
+		require.NoError(t, err)
+		_, err = src.Set([]byte(fmt.Sprintf("staking/%02d", i)), []byte(fmt.Sprintf("stake%d", i)))
+		require.NoError(t, err)
+	}
+	_, _, err := src.SaveVersion()
+	require.NoError(t, err)
+
+	st, err := src.ExtractSubtree([]byte("bank/"))
+	require.NoError(t, err)
+	require.Equal(t, 50, st.Size())
+	require.Equal(t, []byte("00"), st.Pairs()[0].Key)
+	require.Equal(t, int64(50), src.Size())
+	has, err := src.Has([]byte("bank/10"))
+	require.NoError(t, err)
+	require.False(t, has)
+	_, _, err = src.SaveVersion()
+	require.NoError(t, err)
+
+	// the subtree hashes independently of its location
+	expected := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	for i := 0; i < 50; i++ {
+		_, err := expected.Set([]byte(fmt.Sprintf("%02d", i)), []byte(fmt.Sprintf("balance%d", i)))
+		require.NoError(t, err)
+	}
+	hash, err := st.Hash()
+	require.NoError(t, err)
+	require.Equal(t, expected.WorkingHash(), hash)
+
+	dst := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	_, err = dst.Set([]byte("gov/proposal"), []byte("1"))
+	require.NoError(t, err)
+	require.NoError(t, dst.AttachSubtree([]byte("x/bank/"), st))
+	_, _, err = dst.SaveVersion()
+	require.NoError(t, err)
+
+	require.Equal(t, int64(51), dst.Size())
+	for i := 0; i < 50; i++ {
+		value, err := dst.Get([]byte(fmt.Sprintf("x/bank/%02d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("balance%d", i)), value)
+	}
+
+	// attaching over existing keys is refused
+	require.Error(t, dst.AttachSubtree([]byte("x/bank/"), st))
+	require.Error(t, dst.AttachSubtree(nil, st))
+
+	// a prefix ending in 0xff covers no key outside of it
+	_, err = dst.Set([]byte("y"), []byte("outside"))
+	require.NoError(t, err)
+	require.NoError(t, dst.AttachSubtree([]byte("x\xff"), st))
+	st, err = dst.ExtractSubtree([]byte("x\xff"))
+	require.NoError(t, err)
+	require.Equal(t, 50, st.Size())
+	hash, err = st.Hash()
+	require.NoError(t, err)
+	require.Equal(t, expected.WorkingHash(), hash)
+	value, err := dst.Get([]byte("y"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("outside"), value)
+}
+
+func TestStoreKey(t *testing.T) {
+	stores := []string{"acc", "account", "a"}
+	for _, store := range stores {
+		for _, key := range [][]byte{nil, []byte("x"), []byte("unt/x")} {
+			full := JoinStoreKey(store, key)
+			split, rest, ok := SplitStoreKey(full, stores)
+			require.True(t, ok)
+			require.Equal(t, store, split)
+			require.Equal(t, string(key), string(rest))
+		}
+	}
+
+	// the keys of "acc" never fall under the prefix of "account", and the other way around
+	prefix := JoinStoreKey("acc", nil)
+	require.False(t, bytes.HasPrefix(JoinStoreKey("account", []byte("x")), prefix))
+	require.NotEqual(t, JoinStoreKey("acc", []byte("ount/x")), JoinStoreKey("account", []byte("/x")))
+
+	_, _, ok := SplitStoreKey(JoinStoreKey("bank", []byte("x")), stores)
+	require.False(t, ok)
+	_, _, ok = SplitStoreKey([]byte{10, 'a'}, stores)
+	require.False(t, ok)
+	_, _, ok = SplitStoreKey(nil, stores)
+	require.False(t, ok)
+}
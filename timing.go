@@ -0,0 +1,91 @@
+package iavl
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/cosmos/iavl/internal/encoding"
+)
+
+// VersionTiming describes how long it took to save a single version, and how much was written.
+// The record is written in the same batch as the version, so the final commit is not timed.
+type VersionTiming struct {
+	Version int64
+	// HashDuration is the time spent assigning node keys to the new nodes and hashing them.
+	HashDuration time.Duration
+	// SaveDuration is the time spent staging the new nodes and fast nodes in the batch.
+	SaveDuration time.Duration
+	// Nodes is the number of new tree nodes written by the version.
+	Nodes int64
+	// Bytes is the encoded size of the new tree nodes written by the version.
+	Bytes int64
+}
+
+func (vt *VersionTiming) writeBytes(w *bytes.Buffer) error {
+	for _, v := range []int64{int64(vt.HashDuration), int64(vt.SaveDuration), vt.Nodes, vt.Bytes} {
+		if err := encoding.EncodeVarint(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func makeVersionTiming(version int64, buf []byte) (*VersionTiming, error) {
+	fields := make([]int64, 4)
+	for i := range fields {
+		v, n, err := encoding.DecodeVarint(buf)
+		if err != nil {
+			return nil, fmt.Errorf("decoding version timing, %w", err)
+		}
+		fields[i] = v
+		buf = buf[n:]
+	}
+	return &VersionTiming{
+		Version:      version,
+		HashDuration: time.Duration(fields[0]),
+		SaveDuration: time.Duration(fields[1]),
+		Nodes:        fields[2],
+		Bytes:        fields[3],
+	}, nil
+}
+
+// SaveVersionTiming stages the timing record of a version, to be committed along with it.
+func (ndb *nodeDB) SaveVersionTiming(vt *VersionTiming) error {
+	var buf bytes.Buffer
+	if err := vt.writeBytes(&buf); err != nil {
+		return err
+	}
+	ndb.mtx.Lock()
+	defer ndb.mtx.Unlock()
+	return ndb.batch.Set(timingKeyFormat.Key(vt.Version), buf.Bytes())
+}
+
+// VersionTimings returns the recorded commit timings of the versions in [from, to], ordered by
+// version. Versions committed without Options.RecordTimings have no record and are skipped.
+func (ndb *nodeDB) VersionTimings(from, to int64) ([]*VersionTiming, error) {
+	timings := []*VersionTiming{}
+	err := ndb.traverseRange(timingKeyFormat.Key(from), timingKeyFormat.Key(to+1), func(k, v []byte) error {
+		var version int64
+		timingKeyFormat.Scan(k, &version)
+		vt, err := makeVersionTiming(version, v)
+		if err != nil {
+			return err
+		}
+		timings = append(timings, vt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return timings, nil
+}
+
+// VersionTimings returns the recorded commit timings of the versions in [from, to]. Timings are
+// kept across restarts, and survive the pruning of the versions they describe.
+func (tree *MutableTree) VersionTimings(from, to int64) ([]*VersionTiming, error) {
+	if err := tree.checkOpen(); err != nil {
+		return nil, err
+	}
+	return tree.ndb.VersionTimings(from, to)
+}
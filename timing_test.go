@@ -0,0 +1,63 @@
+package iavl
+
+import (
+	"fmt"
+	"testing"
+
+	"cosmossdk.io/log"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/cosmos/iavl/db"
+)
+
+func TestVersionTimings(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := NewMutableTree(db, 0, false, log.NewNopLogger(), RecordTimingsOption(true))
+
+	for v := 0; v < 3; v++ {
+		for i := 0; i < 10; i++ {
+			_, err := tree.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d-%d", v, i)))
+			require.NoError(t, err)
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	// a version without changes writes no new nodes
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	// timings are persisted across restarts
+	tree = NewMutableTree(db, 0, false, log.NewNopLogger(), RecordTimingsOption(true))
+	_, err = tree.Load()
+	require.NoError(t, err)
+
+	timings, err := tree.VersionTimings(1, 4)
+	require.NoError(t, err)
+	require.Len(t, timings, 4)
+	for i, vt := range timings[:3] {
+		require.Equal(t, int64(i+1), vt.Version)
+		require.Positive(t, vt.Nodes)
+		require.Positive(t, vt.Bytes)
+		require.Positive(t, vt.HashDuration)
+		require.Positive(t, vt.SaveDuration)
+	}
+	require.Equal(t, int64(4), timings[3].Version)
+	require.Zero(t, timings[3].Nodes)
+	require.Zero(t, timings[3].HashDuration)
+
+	timings, err = tree.VersionTimings(2, 3)
+	require.NoError(t, err)
+	require.Len(t, timings, 2)
+	require.Equal(t, int64(2), timings[0].Version)
+	require.Equal(t, int64(3), timings[1].Version)
+
+	// nothing is recorded without the option
+	tree = NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	_, err = tree.Set([]byte("key"), []byte("value"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	timings, err = tree.VersionTimings(1, 1)
+	require.NoError(t, err)
+	require.Empty(t, timings)
+}
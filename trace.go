@@ -0,0 +1,124 @@
+package iavl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/cosmos/iavl/internal/encoding"
+)
+
+// Operation trace record types, see Options.TraceWriter.
+const (
+	traceOpSet byte = iota + 1
+	traceOpRemove
+	traceOpSaveVersion
+	traceOpRollback
+)
+
+// maxTraceRecordSize bounds the length of a trace record body, so that ReplayTrace reports a
+// corrupted length rather than allocating it. Larger records are not written.
+const maxTraceRecordSize = 64 << 20
+
+var traceCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// writeTrace appends a record to the operation trace, if one is configured. A record is the
+// uvarint length of its body, the body, and the big-endian CRC-32C of the body. The body is the
+// operation type followed by its length-prefixed fields.
+func (tree *MutableTree) writeTrace(op byte, fields ...[]byte) error {
+	w := tree.ndb.opts.TraceWriter
+	if w == nil {
+		return nil
+	}
+	var body bytes.Buffer
+	body.WriteByte(op)
+	for _, field := range fields {
+		if err := encoding.EncodeBytes(&body, field); err != nil {
+			return err
+		}
+	}
+	if body.Len() > maxTraceRecordSize {
+		return fmt.Errorf("trace record length %d exceeds the maximum of %d", body.Len(), maxTraceRecordSize)
+	}
+	record := binary.AppendUvarint(nil, uint64(body.Len()))
+	record = append(record, body.Bytes()...)
+	record = binary.BigEndian.AppendUint32(record, crc32.Checksum(body.Bytes(), traceCRCTable))
+	if _, err := w.Write(record); err != nil {
+		return fmt.Errorf("failed to write the operation trace: %w", err)
+	}
+	return nil
+}
+
+// traceSaveVersion records a saved version along with its hash, which ReplayTrace checks.
+func (tree *MutableTree) traceSaveVersion(version int64, hash []byte) error {
+	return tree.writeTrace(traceOpSaveVersion, binary.BigEndian.AppendUint64(nil, uint64(version)), hash)
+}
+
+// ReplayTrace re-executes on tree the operations recorded through Options.TraceWriter, in the
+// order they were made. Every saved version must get the same version number and hash as when
+// it was recorded, so that a replay into an empty tree reproduces the traced tree exactly.
+func ReplayTrace(r io.Reader, tree *MutableTree) error {
+	br := bufio.NewReader(r)
+	for {
+		size, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid trace record length: %w", err)
+		}
+		if size > maxTraceRecordSize {
+			return fmt.Errorf("trace record length %d exceeds the maximum of %d", size, maxTraceRecordSize)
+		}
+		record := make([]byte, size+4)
+		if _, err := io.ReadFull(br, record); err != nil {
+			return fmt.Errorf("truncated trace record: %w", err)
+		}
+		body := record[:size]
+		if crc32.Checksum(body, traceCRCTable) != binary.BigEndian.Uint32(record[size:]) {
+			return errors.New("trace record checksum mismatch")
+		}
+		if len(body) == 0 {
+			return errors.New("empty trace record")
+		}
+
+		var fields [][]byte
+		for rest := body[1:]; len(rest) > 0; {
+			field, n, err := encoding.DecodeBytes(rest)
+			if err != nil {
+				return fmt.Errorf("invalid trace record: %w", err)
+			}
+			fields = append(fields, field)
+			rest = rest[n:]
+		}
+
+		switch op := body[0]; {
+		case op == traceOpSet && len(fields) == 2:
+			if _, err := tree.Set(fields[0], fields[1]); err != nil {
+				return err
+			}
+		case op == traceOpRemove && len(fields) == 1:
+			if _, _, err := tree.Remove(fields[0]); err != nil {
+				return err
+			}
+		case op == traceOpSaveVersion && len(fields) == 2 && len(fields[0]) == 8:
+			hash, version, err := tree.SaveVersion()
+			if err != nil {
+				return err
+			}
+			traced := int64(binary.BigEndian.Uint64(fields[0]))
+			if version != traced || !bytes.Equal(hash, fields[1]) {
+				return fmt.Errorf("replayed version %d with hash %X, but version %d was traced with hash %X",
+					version, hash, traced, fields[1])
+			}
+		case op == traceOpRollback && len(fields) == 0:
+			tree.Rollback()
+		default:
+			return fmt.Errorf("invalid trace record of type %d with %d fields", op, len(fields))
+		}
+	}
+}
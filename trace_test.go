@@ -0,0 +1,73 @@
+package iavl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"cosmossdk.io/log"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/cosmos/iavl/db"
+	iavlrand "github.com/cosmos/iavl/internal/rand"
+)
+
+func TestReplayTrace(t *testing.T) {
+	var trace bytes.Buffer
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), TraceWriterOption(&trace))
+	r := iavlrand.NewRand()
+	r.Seed(7)
+	var hashes [][]byte
+	for version := 0; version < 5; version++ {
+		for i := 0; i < 200; i++ {
+			key := []byte(fmt.Sprintf("key-%02d", r.Intn(50)))
+			if r.Intn(3) == 0 {
+				_, _, err := tree.Remove(key)
+				require.NoError(t, err)
+				continue
+			}
+			_, err := tree.Set(key, r.Bytes(4))
+			require.NoError(t, err)
+		}
+		if version == 2 {
+			// changes discarded by a rollback are not replayed
+			_, err := tree.Set([]byte("discarded"), []byte("value"))
+			require.NoError(t, err)
+			tree.Rollback()
+		}
+		hash, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+	record := trace.Bytes()
+
+	replayed := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	require.NoError(t, ReplayTrace(bytes.NewReader(record), replayed))
+	require.EqualValues(t, 5, replayed.Version())
+	for i, hash := range hashes {
+		itree, err := replayed.GetImmutable(int64(i + 1))
+		require.NoError(t, err)
+		require.Equal(t, hash, itree.Hash())
+	}
+
+	// a replay into a tree which diverged is detected at the next saved version
+	diverged := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger())
+	_, err := diverged.Set([]byte("extra"), []byte("value"))
+	require.NoError(t, err)
+	err = ReplayTrace(bytes.NewReader(record), diverged)
+	require.ErrorContains(t, err, "but version 1 was traced with hash")
+
+	corrupted := bytes.Clone(record)
+	corrupted[3] ^= 0xff
+	err = ReplayTrace(bytes.NewReader(corrupted), NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger()))
+	require.EqualError(t, err, "trace record checksum mismatch")
+
+	err = ReplayTrace(bytes.NewReader(record[:len(record)-2]), NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger()))
+	require.ErrorContains(t, err, "truncated trace record")
+
+	// a corrupted length is rejected before the record is allocated
+	oversized := binary.AppendUvarint(nil, 1<<62)
+	err = ReplayTrace(bytes.NewReader(oversized), NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger()))
+	require.ErrorContains(t, err, "exceeds the maximum")
+}
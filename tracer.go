@@ -0,0 +1,32 @@
+package iavl
+
+// Tracer creates spans around tree operations, e.g. to correlate them with the spans of the
+// block being processed. It is configured with TracerOption, and adapts easily to OpenTelemetry.
+//
+// The spans are named after the operation: iavl.Get, iavl.Set, iavl.Remove and iavl.SaveVersion.
+type Tracer interface {
+	StartSpan(name string) Span
+}
+
+// Span is a single traced operation, ended once the operation returns.
+type Span interface {
+	// SetAttribute records a numeric attribute of the operation, like the version or a size
+	// in bytes.
+	SetAttribute(key string, value int64)
+	End()
+}
+
+// noopSpan is used when no Tracer is configured, so tracing costs nothing when unused.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, int64) {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span with the configured Tracer, if any. In-memory immutable trees have
+// no nodeDB, and are never traced.
+func (ndb *nodeDB) startSpan(name string) Span {
+	if ndb == nil || ndb.opts.Tracer == nil {
+		return noopSpan{}
+	}
+	return ndb.opts.Tracer.StartSpan(name)
+}
@@ -0,0 +1,66 @@
+package iavl
+
+import (
+	"testing"
+
+	"cosmossdk.io/log"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/cosmos/iavl/db"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]int64
+	ended bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value int64) { s.attrs[key] = value }
+func (s *recordedSpan) End()                                 { s.ended = true }
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name string) Span {
+	span := &recordedSpan{name: name, attrs: map[string]int64{}}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), TracerOption(tracer))
+
+	_, err := tree.Set([]byte("key"), []byte("value"))
+	require.NoError(t, err)
+	_, err = tree.Set([]byte("other"), []byte("v"))
+	require.NoError(t, err)
+	_, _, err = tree.Remove([]byte("other"))
+	require.NoError(t, err)
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	value, err := tree.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+	itree, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+	_, err = itree.Get([]byte("key"))
+	require.NoError(t, err)
+
+	names := make([]string, len(tracer.spans))
+	for i, span := range tracer.spans {
+		names[i] = span.name
+		require.True(t, span.ended, "span %s not ended", span.name)
+	}
+	require.Equal(t, []string{"iavl.Set", "iavl.Set", "iavl.Remove", "iavl.SaveVersion", "iavl.Get", "iavl.Get"}, names)
+
+	require.Equal(t, map[string]int64{"version": 1, "key_bytes": 3, "value_bytes": 5}, tracer.spans[0].attrs)
+	require.Equal(t, map[string]int64{"version": 1, "key_bytes": 5}, tracer.spans[2].attrs)
+	save := tracer.spans[3].attrs
+	require.Equal(t, int64(1), save["version"])
+	require.Equal(t, int64(1), save["nodes"])
+	require.Positive(t, save["bytes"])
+	require.Equal(t, map[string]int64{"version": 2, "key_bytes": 3, "value_bytes": 5}, tracer.spans[4].attrs)
+	require.Equal(t, map[string]int64{"version": 1, "key_bytes": 3, "value_bytes": 5}, tracer.spans[5].attrs)
+}
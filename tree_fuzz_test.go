@@ -2,6 +2,7 @@
 package iavl
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -125,3 +126,74 @@ func TestMutableTreeFuzz(t *testing.T) {
 		}
 	}
 }
+
+// FuzzTreeSetRemove decodes the input as a sequence of operations of 3 bytes each: an opcode, a
+// key and a value. After every save, it checks the AVL invariants of the saved tree and compares
+// its content with a map.
+func FuzzTreeSetRemove(f *testing.F) {
+	f.Add([]byte{0, 'a', 1, 0, 'b', 2, 0, 'c', 3, 2, 0, 0, 1, 'b', 0, 2, 0, 0})
+	f.Add([]byte{0, 1, 1, 0, 2, 2, 0, 3, 3, 0, 4, 4, 0, 5, 5, 1, 1, 0, 1, 2, 0, 2, 0, 0})
+	f.Add([]byte{0, 9, 1, 0, 8, 1, 0, 7, 1, 2, 0, 0, 1, 8, 0, 0, 8, 2, 1, 7, 0, 2, 0, 0, 1, 9, 0, 1, 8, 0})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		tree := getTestTree(0)
+		expected := map[string][]byte{}
+		for ; len(ops) >= 3; ops = ops[3:] {
+			// keep the key space small, so that removals hit existing keys
+			key, value := []byte{ops[1] % 32}, []byte{ops[2]}
+			switch ops[0] % 3 {
+			case 0:
+				_, err := tree.Set(key, value)
+				require.NoError(t, err)
+				expected[string(key)] = value
+			case 1:
+				_, _, err := tree.Remove(key)
+				require.NoError(t, err)
+				delete(expected, string(key))
+			case 2:
+				_, _, err := tree.SaveVersion()
+				require.NoError(t, err)
+				checkTreeInvariants(t, tree, expected)
+			}
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+		checkTreeInvariants(t, tree, expected)
+	})
+}
+
+func checkTreeInvariants(t *testing.T, tree *MutableTree, expected map[string][]byte) {
+	var prev []byte
+	// check returns the height and size of the subtree, and its leftmost key
+	var check func(node *Node) (int8, int64, []byte)
+	check = func(node *Node) (int8, int64, []byte) {
+		if node.isLeaf() {
+			require.True(t, prev == nil || bytes.Compare(prev, node.key) < 0, "keys are not sorted")
+			prev = node.key
+			require.EqualValues(t, 1, node.size)
+			return 0, 1, node.key
+		}
+		left, err := node.getLeftNode(tree.ImmutableTree)
+		require.NoError(t, err)
+		right, err := node.getRightNode(tree.ImmutableTree)
+		require.NoError(t, err)
+		leftHeight, leftSize, leftmost := check(left)
+		rightHeight, rightSize, rightLeftmost := check(right)
+		require.Equal(t, maxInt8(leftHeight, rightHeight)+1, node.subtreeHeight)
+		require.LessOrEqual(t, leftHeight-rightHeight, int8(1))
+		require.GreaterOrEqual(t, leftHeight-rightHeight, int8(-1))
+		require.Equal(t, leftSize+rightSize, node.size)
+		require.Equal(t, rightLeftmost, node.key, "branch key is not the leftmost key of its right subtree")
+		return node.subtreeHeight, node.size, leftmost
+	}
+	if tree.root != nil {
+		check(tree.root)
+	}
+
+	require.EqualValues(t, len(expected), tree.Size())
+	for key, value := range expected {
+		actual, err := tree.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, value, actual)
+	}
+}
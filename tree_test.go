@@ -10,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
 	"testing"
 
 	"cosmossdk.io/log"
@@ -1240,8 +1241,10 @@ func TestRollback(t *testing.T) {
 
 	tree.Set([]byte("r"), []byte("v"))
 	tree.Set([]byte("s"), []byte("v"))
+	require.NotEqual(tree.Hash(), tree.WorkingHash())
 
 	tree.Rollback()
+	require.Equal(tree.Hash(), tree.WorkingHash())
 
 	tree.Set([]byte("t"), []byte("v"))
 
@@ -1638,6 +1641,13 @@ func TestGetByIndex_ImmutableTree(t *testing.T) {
 		require.Equal(t, expectedKey, string(actualKey))
 		require.Equal(t, expectedValue, string(actualValue))
 	}
+
+	for _, index := range []int64{-1, int64(len(mirrorKeys))} {
+		key, value, err := immutableTree.GetByIndex(index)
+		require.NoError(t, err)
+		require.Nil(t, key)
+		require.Nil(t, value)
+	}
 }
 
 func TestGetWithIndex_ImmutableTree(t *testing.T) {
@@ -1885,3 +1895,246 @@ func TestReferenceRoot(t *testing.T) {
 	require.Equal(t, tree.root.GetKey(), (&NodeKey{version: 1, nonce: 3}).GetKey())
 	require.Equal(t, tree.root.key, []byte("key2"))
 }
+
+func TestWarmKeys(t *testing.T) {
+	db, err := dbm.NewDB("test", "memdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	tree := NewMutableTree(db, 0, true, log.NewNopLogger())
+	for i := 0; i < 1000; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprintf("value%04d", i)))
+		require.NoError(t, err)
+	}
+	_, ver, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	stat := &Statistics{}
+	tree = NewMutableTree(db, 1000, true, log.NewNopLogger(), StatOption(stat))
+	_, err = tree.LoadVersion(ver)
+	require.NoError(t, err)
+
+	keys := [][]byte{[]byte("key0001"), []byte("key0500"), []byte("key0501"), []byte("key0999"), []byte("missing")}
+	require.NoError(t, tree.WarmKeys(keys))
+
+	stat.Reset()
+	for _, key := range keys {
+		_, _, err := tree.GetWithIndex(key)
+		require.NoError(t, err)
+	}
+	require.Zero(t, stat.GetCacheMissCnt())
+
+	value, err := tree.Get([]byte("key0500"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value0500"), value)
+}
+
+func TestGetBatch(t *testing.T) {
+	tree := getTestTree(0)
+	for i := 0; i < 500; i += 2 {
+		_, err := tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%03d", i)))
+		require.NoError(t, err)
+	}
+
+	keys := [][]byte{
+		[]byte("key100"), []byte("key001"), []byte("key498"), []byte("key000"),
+		[]byte("key100"), []byte("missing"), []byte("key250"), []byte("key251"),
+	}
+	check := func(itree *ImmutableTree) {
+		values, err := itree.GetBatch(keys)
+		require.NoError(t, err)
+		require.Len(t, values, len(keys))
+		for i, key := range keys {
+			expected, err := itree.Get(key)
+			require.NoError(t, err)
+			require.Equal(t, expected, values[i], "key %s", key)
+		}
+		require.Nil(t, values[1])
+		require.Equal(t, []byte("value100"), values[4])
+	}
+
+	// unsaved working tree
+	check(tree.ImmutableTree)
+
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	itree, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+	check(itree)
+
+	values, err := itree.GetBatch(nil)
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func BenchmarkGetBatch(b *testing.B) {
+	const numKeyVals = 100000
+	const batchSize = 1000
+
+	tree := NewMutableTree(dbm.NewMemDB(), 0, true, log.NewNopLogger())
+	keys := make([][]byte, 0, numKeyVals)
+	for i := 0; i < numKeyVals; i++ {
+		key := iavlrand.RandBytes(10)
+		keys = append(keys, key)
+		_, err := tree.Set(key, iavlrand.RandBytes(10))
+		require.NoError(b, err)
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(b, err)
+
+	batch := make([][]byte, batchSize)
+	for i := range batch {
+		batch[i] = keys[rand.Intn(numKeyVals)]
+	}
+
+	b.ReportAllocs()
+	b.Run("loop", func(sub *testing.B) {
+		for i := 0; i < sub.N; i++ {
+			for _, key := range batch {
+				_, err := tree.Get(key)
+				require.NoError(sub, err)
+			}
+		}
+	})
+
+	b.Run("batch", func(sub *testing.B) {
+		for i := 0; i < sub.N; i++ {
+			_, err := tree.GetBatch(batch)
+			require.NoError(sub, err)
+		}
+	})
+}
+
+func TestLargestLeaves(t *testing.T) {
+	tree := getTestTree(0)
+	sizes := map[string]int{"a": 10, "b": 300, "c": 25, "d": 300, "e": 1, "f": 120, "g": 75}
+	for key, size := range sizes {
+		_, err := tree.Set([]byte(key), make([]byte, size))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+
+	// shrink b in the next version, the saved version is unaffected
+	_, err = tree.Set([]byte("b"), []byte{1})
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+
+	leaves, err := tree.LargestLeaves(3, version)
+	require.NoError(t, err)
+	require.Equal(t, []LeafInfo{
+		{Key: []byte("b"), ValueSize: 300},
+		{Key: []byte("d"), ValueSize: 300},
+		{Key: []byte("f"), ValueSize: 120},
+	}, leaves)
+
+	leaves, err = tree.LargestLeaves(3, version+1)
+	require.NoError(t, err)
+	require.Equal(t, []LeafInfo{
+		{Key: []byte("d"), ValueSize: 300},
+		{Key: []byte("f"), ValueSize: 120},
+		{Key: []byte("g"), ValueSize: 75},
+	}, leaves)
+
+	leaves, err = tree.LargestLeaves(100, version)
+	require.NoError(t, err)
+	require.Len(t, leaves, len(sizes))
+	require.Equal(t, LeafInfo{Key: []byte("e"), ValueSize: 1}, leaves[len(leaves)-1])
+
+	_, err = tree.LargestLeaves(0, version)
+	require.Error(t, err)
+	_, err = tree.LargestLeaves(3, version+5)
+	require.ErrorIs(t, err, ErrVersionDoesNotExist)
+}
+
+func TestVersionStats(t *testing.T) {
+	tree := getTestTree(0)
+	for i := 0; i < 100; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key-%02d", i)), make([]byte, i))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	_, _, err = tree.Remove([]byte("key-99"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+
+	saved, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+	stats, err := tree.VersionStats(version)
+	require.NoError(t, err)
+	require.Equal(t, TreeStats{
+		Leaves:     100,
+		Branches:   99,
+		Height:     saved.Height(),
+		KeyBytes:   600,
+		ValueBytes: 99 * 100 / 2,
+	}, stats)
+
+	stats, err = tree.VersionStats(version + 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 99, stats.Leaves)
+	require.EqualValues(t, 98*99/2, stats.ValueBytes)
+
+	_, err = tree.VersionStats(version + 2)
+	require.ErrorIs(t, err, ErrVersionDoesNotExist)
+}
+
+func TestStatisticsSub(t *testing.T) {
+	stat := &Statistics{}
+	tree := NewMutableTree(dbm.NewMemDB(), 0, false, log.NewNopLogger(), StatOption(stat))
+	for i := 0; i < 100; i++ {
+		_, err := tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte("value"))
+		require.NoError(t, err)
+	}
+	_, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	itree, err := tree.GetImmutable(version)
+	require.NoError(t, err)
+	_, err = itree.Get([]byte("key000"))
+	require.NoError(t, err)
+
+	base := stat.Snapshot()
+	require.NotZero(t, base.GetFastCacheHitCnt()+base.GetCacheMissCnt())
+	for i := 0; i < 10; i++ {
+		_, err := itree.Get([]byte(fmt.Sprintf("key%03d", i)))
+		require.NoError(t, err)
+	}
+	_, _, err = itree.GetWithIndex([]byte("key050"))
+	require.NoError(t, err)
+
+	delta := stat.Sub(base)
+	require.EqualValues(t, 10, delta.GetFastCacheHitCnt())
+	require.Zero(t, delta.GetFastCacheMissCnt())
+	require.Zero(t, delta.GetCacheHitCnt())
+	require.EqualValues(t, itree.root.subtreeHeight, delta.GetCacheMissCnt())
+}
+
+func TestStatisticsConcurrent(t *testing.T) {
+	stat := &Statistics{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				stat.IncCacheHitCnt()
+				stat.IncCacheMissCnt()
+				stat.IncFastCacheHitCnt()
+				stat.IncFastCacheMissCnt()
+				_ = stat.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := stat.Snapshot()
+	for _, count := range []uint64{
+		snapshot.GetCacheHitCnt(), snapshot.GetCacheMissCnt(),
+		snapshot.GetFastCacheHitCnt(), snapshot.GetFastCacheMissCnt(),
+	} {
+		require.EqualValues(t, 8000, count)
+	}
+}
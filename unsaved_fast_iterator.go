@@ -39,14 +39,17 @@ type UnsavedFastIterator struct {
 
 var _ dbm.Iterator = (*UnsavedFastIterator)(nil)
 
+// NewUnsavedFastIterator returns an iterator over the saved fast nodes merged with the given unsaved
+// changes. The unsaved changes are copied when the iterator is created, so the iterator keeps
+// seeing the working tree as of its creation even if keys are set or removed afterwards.
 func NewUnsavedFastIterator(start, end []byte, ascending bool, ndb *nodeDB, unsavedFastNodeAdditions, unsavedFastNodeRemovals *sync.Map) *UnsavedFastIterator {
 	iter := &UnsavedFastIterator{
 		start:                    start,
 		end:                      end,
 		ascending:                ascending,
 		ndb:                      ndb,
-		unsavedFastNodeAdditions: unsavedFastNodeAdditions,
-		unsavedFastNodeRemovals:  unsavedFastNodeRemovals,
+		unsavedFastNodeAdditions: &sync.Map{},
+		unsavedFastNodeRemovals:  &sync.Map{},
 		nextKey:                  nil,
 		nextVal:                  nil,
 		nextUnsavedNodeIdx:       0,
@@ -59,17 +62,23 @@ func NewUnsavedFastIterator(start, end []byte, ascending bool, ndb *nodeDB, unsa
 		return iter
 	}
 
-	if iter.unsavedFastNodeAdditions == nil {
+	if unsavedFastNodeAdditions == nil {
 		iter.err = errUnsavedFastIteratorNilAdditionsGiven
 		iter.valid = false
 		return iter
 	}
 
-	if iter.unsavedFastNodeRemovals == nil {
+	if unsavedFastNodeRemovals == nil {
 		iter.err = errUnsavedFastIteratorNilRemovalsGiven
 		iter.valid = false
 		return iter
 	}
+
+	unsavedFastNodeRemovals.Range(func(k, v interface{}) bool {
+		iter.unsavedFastNodeRemovals.Store(k, v)
+		return true
+	})
+
 	// We need to ensure that we iterate over saved and unsaved state in order.
 	// The strategy is to sort unsaved nodes, the fast node on disk are already sorted.
 	// Then, we keep a pointer to both the unsaved and saved nodes, and iterate over them in order efficiently.
@@ -86,6 +95,7 @@ func NewUnsavedFastIterator(start, end []byte, ascending bool, ndb *nodeDB, unsa
 
 		// convert key to bytes. Type conversion failure should not happen in practice
 		iter.unsavedFastNodesToSort = append(iter.unsavedFastNodesToSort, k.(string))
+		iter.unsavedFastNodeAdditions.Store(k, fastNode)
 
 		return true
 	})
@@ -61,3 +61,18 @@ func maxInt8(a, b int8) int8 {
 	}
 	return b
 }
+
+// prefixEnd returns the exclusive end of the range of keys with the given prefix, i.e. the prefix
+// with its last byte below 0xff incremented and the following bytes dropped, or nil if there is
+// no such byte and the range is unbounded.
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}